@@ -0,0 +1,78 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileLogger appends timestamped log messages to the --log-file, if set
+var fileLogger *log.Logger
+
+// OpenLogFile appends all log messages (including those not displayed without
+// verbose output) & errors to a log file. If the log file is larger than maxSize
+// it is first rotated to <file>.1, replacing any previous rotated log.
+func OpenLogFile(file string, maxSize int64) error {
+	if info, err := os.Stat(file); err == nil && maxSize > 0 && info.Size() > maxSize {
+		if err := os.Rename(file, file+".1"); err != nil {
+			return fmt.Errorf("Error rotating log file '%s': %s", file, err.Error())
+		}
+	}
+
+	f, err := os.OpenFile(filepath.Clean(file), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("Error opening log file '%s': %s", file, err.Error())
+	}
+
+	fileLogger = log.New(f, "", log.LstdFlags)
+	LogToFile("INFO", "Running: ssbak "+strings.Join(redactArgs(os.Args[1:]), " "))
+
+	return nil
+}
+
+// RedactArgs returns the command line arguments with the values of any password or
+// passphrase flags (eg: --to-password=secret or --to-password secret) replaced by ***
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	secret := false
+	for i, arg := range args {
+		if secret {
+			redacted[i] = "***"
+			secret = false
+			continue
+		}
+		redacted[i] = arg
+
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.ToLower(strings.TrimLeft(arg, "-"))
+		value := ""
+		if n := strings.Index(name, "="); n != -1 {
+			name, value = name[:n], arg[strings.Index(arg, "=")+1:]
+		}
+		// files (eg: --password-file) only contain the secret
+		if (!strings.Contains(name, "password") && !strings.Contains(name, "passphrase")) || strings.HasSuffix(name, "-file") {
+			continue
+		}
+
+		if strings.Contains(arg, "=") {
+			redacted[i] = arg[:len(arg)-len(value)] + "***"
+		} else {
+			secret = true
+		}
+	}
+
+	return redacted
+}
+
+// LogToFile writes a message to the log file (if any), prefixed with its level
+func LogToFile(level, msg string) {
+	if fileLogger == nil {
+		return
+	}
+
+	fileLogger.Printf("%-5s %s", level, msg)
+}
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		args string
+		want string
+	}{
+		{"save ./ site.sspak -v", "save ./ site.sspak -v"},
+		{"migrate ./ --to-password=secret --to-host=db", "migrate ./ --to-password=*** --to-host=db"},
+		{"migrate ./ --to-password secret --to-host db", "migrate ./ --to-password *** --to-host db"},
+		{"migrate ./ --to-password=a=b", "migrate ./ --to-password=***"},
+		{"save ./ --passphrase=root", "save ./ --passphrase=***"},
+		{"save ./ --password-file=/run/secrets/db", "save ./ --password-file=/run/secrets/db"},
+		{"save ./ root.sspak --to-password=", "save ./ root.sspak --to-password=***"},
+	}
+
+	for _, tt := range tests {
+		got := strings.Join(redactArgs(strings.Fields(tt.args)), " ")
+		if got != tt.want {
+			t.Errorf("redactArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
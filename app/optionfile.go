@@ -0,0 +1,91 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MySQL option files (eg: ~/.my.cnf) are INI files, with the client connection
+// settings in the [client] section, optionally overridden by the [mysql] &
+// [mysqldump] sections.
+var optionFileSections = []string{"client", "mysql", "mysqldump"}
+
+// SetFromOptionFile sets the database host, port, socket, user & password from a
+// MySQL option file. Settings in the option file replace any others.
+func setFromOptionFile(file string) error {
+	options, err := readOptionFile(file)
+	if err != nil {
+		return fmt.Errorf("Cannot read MySQL option file '%s': %s", file, err.Error())
+	}
+
+	Log(fmt.Sprintf("Reading database credentials from %s", file))
+
+	for _, section := range optionFileSections {
+		for key, value := range options[section] {
+			switch key {
+			case "host":
+				DB.Host = value
+			case "port":
+				DB.Port = value
+			case "socket":
+				DB.Socket = value
+			case "user":
+				DB.Username = value
+			case "password":
+				DB.Password = value
+			}
+		}
+	}
+
+	return nil
+}
+
+// ReadOptionFile parses a MySQL option file into a map of sections to options.
+// Option names are lowercase with dashes converted to underscores, and quoted
+// values are unquoted.
+func readOptionFile(file string) (map[string]map[string]string, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() // #nosec
+
+	options := map[string]map[string]string{}
+	section := ""
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "!") {
+			// ignore comments, blank lines & !include directives
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		key := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(parts[0])), "-", "_")
+		value := ""
+		if len(parts) == 2 {
+			value = strings.TrimSpace(parts[1])
+			if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+				value = value[1 : len(value)-1]
+			}
+		}
+
+		if options[section] == nil {
+			options[section] = map[string]string{}
+		}
+		options[section][key] = value
+	}
+
+	return options, scanner.Err()
+}
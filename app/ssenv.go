@@ -5,11 +5,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -33,7 +33,13 @@ func BootstrapEnv(dir string) error {
 
 	ProjectRoot = d
 
-	if !dotEnvIgnored() {
+	if EnvFile != "" {
+		Log(fmt.Sprintf("Parsing %s", EnvFile))
+		if err := godotenv.Load(EnvFile); err != nil {
+			return fmt.Errorf("Cannot read environment file '%s': %s", EnvFile, err.Error())
+		}
+		setFromDBEnv()
+	} else if !dotEnvIgnored() {
 		conf, err := findConfig(ProjectRoot)
 		if err == nil {
 			Log(fmt.Sprintf("Parsing %s", conf.Path))
@@ -59,38 +65,94 @@ func BootstrapEnv(dir string) error {
 		return errors.New("No database defined")
 	}
 
-	if DB.Username == "" {
-		return errors.New("No database user defined")
-	}
-
-	// MySQLPDODatabase, MySQLDatabase, MSSQLDatabase, PostgreSQLDatabase
-	if DB.Type == "" || strings.Contains(strings.ToLower(DB.Type), "mysql") {
+	// MySQLPDODatabase, MySQLDatabase, MSSQLDatabase, PostgreSQLDatabase, SQLite3Database
+	dbType := strings.ToLower(DB.Type)
+	if DB.Type == "" || strings.Contains(dbType, "mysql") {
 		DB.Type = "MySQL"
+	} else if strings.Contains(dbType, "postgres") {
+		DB.Type = "PostgreSQL"
+	} else if strings.Contains(dbType, "sqlite") {
+		DB.Type = "SQLite"
 	} else {
 		return fmt.Errorf("Database %s not supported", DB.Type)
 	}
 
+	if OptionFile != "" {
+		DB.OptionFile = OptionFile
+	}
+
+	if ConnectTimeout < 1 {
+		return errors.New("--connect-timeout must be at least 1 second")
+	}
+	DB.ConnectTimeout = time.Duration(ConnectTimeout) * time.Second
+
+	if DB.OptionFile != "" {
+		if DB.Type != "MySQL" {
+			return fmt.Errorf("MySQL option files are not supported for %s databases", DB.Type)
+		}
+		if err := setFromOptionFile(DB.OptionFile); err != nil {
+			return err
+		}
+	}
+
+	if PasswordFile != "" {
+		DB.PasswordFile = PasswordFile
+	}
+
+	// the password file takes precedence over any other password
+	if DB.PasswordFile != "" {
+		if err := setFromPasswordFile(DB.PasswordFile); err != nil {
+			return err
+		}
+	}
+
+	// SQLite databases are files, so have no user
+	if DB.Username == "" && DB.Type != "SQLite" {
+		return errors.New("No database user defined")
+	}
+
+	if DB.Charset == "" {
+		DB.Charset = "utf8mb4"
+	} else if !regexp.MustCompile(`^[a-zA-Z0-9_]+$`).MatchString(DB.Charset) {
+		return fmt.Errorf("Invalid database charset: %s", DB.Charset)
+	}
+
+	return nil
+}
+
+// SetFromPasswordFile sets the database password from the contents of a file,
+// without the trailing newline
+func setFromPasswordFile(file string) error {
+	b, err := ioutil.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return fmt.Errorf("Cannot read database password file '%s': %s", file, err.Error())
+	}
+
+	Log(fmt.Sprintf("Reading database password from %s", file))
+
+	DB.Password = strings.TrimRight(string(b), "\r\n")
+
 	return nil
 }
 
 // FindConfig will return a configuration file path & type if found
 func findConfig(dir string) (configFile, error) {
 	r := configFile{}
-	if isFile(path.Join(dir, ".env")) {
-		r.Path = RealPath(path.Join(dir, ".env"))
+	if isFile(filepath.Join(dir, ".env")) {
+		r.Path = RealPath(filepath.Join(dir, ".env"))
 		return r, nil
 	}
-	if isFile(path.Join(filepath.Dir(dir), ".env")) {
-		r.Path = RealPath(path.Join(filepath.Dir(dir), ".env"))
+	if isFile(filepath.Join(filepath.Dir(dir), ".env")) {
+		r.Path = RealPath(filepath.Join(filepath.Dir(dir), ".env"))
 		return r, nil
 	}
-	if isFile(path.Join(dir, "_ss_environment.php")) {
-		r.Path = RealPath(path.Join(dir, "_ss_environment.php"))
+	if isFile(filepath.Join(dir, "_ss_environment.php")) {
+		r.Path = RealPath(filepath.Join(dir, "_ss_environment.php"))
 		r.PHP = true
 		return r, nil
 	}
-	if isFile(path.Join(filepath.Dir(dir), "_ss_environment.php")) {
-		r.Path = RealPath(path.Join(filepath.Dir(dir), "_ss_environment.php"))
+	if isFile(filepath.Join(filepath.Dir(dir), "_ss_environment.php")) {
+		r.Path = RealPath(filepath.Join(filepath.Dir(dir), "_ss_environment.php"))
 		r.PHP = true
 		return r, nil
 	}
@@ -98,6 +160,27 @@ func findConfig(dir string) (configFile, error) {
 	return r, errors.New("Config not found")
 }
 
+// DBEnvKeys maps the generic DB_* keys of an environment file to the database
+// settings, eg: DB_HOST=localhost
+var dbEnvKeys = map[string]*string{
+	"DB_HOST":     &DB.Host,
+	"DB_PORT":     &DB.Port,
+	"DB_USER":     &DB.Username,
+	"DB_PASSWORD": &DB.Password,
+	"DB_NAME":     &DB.Name,
+}
+
+// Extract the generic DB_* variables from the environment if set. These are loaded
+// from an environment file without overriding variables already set, and are in
+// turn overridden by any SS_DATABASE_* variables.
+func setFromDBEnv() {
+	for key, field := range dbEnvKeys {
+		if v, ok := os.LookupEnv(key); ok {
+			*field = v
+		}
+	}
+}
+
 // Extract variables from the system environment if set
 func setFromEnv() {
 	if v, ok := os.LookupEnv("SS_DATABASE_SERVER"); ok {
@@ -121,6 +204,33 @@ func setFromEnv() {
 	if v, ok := os.LookupEnv("SS_DATABASE_PORT"); ok {
 		DB.Port = v
 	}
+	if v, ok := os.LookupEnv("SS_DATABASE_SOCKET"); ok {
+		DB.Socket = v
+	}
+	if v, ok := os.LookupEnv("SS_DATABASE_CHARSET"); ok {
+		DB.Charset = v
+	}
+	if v, ok := os.LookupEnv("SS_SQLITE_DATABASE_PATH"); ok {
+		DB.Path = v
+	}
+	if v, ok := os.LookupEnv("SS_DATABASE_OPTION_FILE"); ok {
+		DB.OptionFile = v
+	}
+	if v, ok := os.LookupEnv("SS_DATABASE_PASSWORD_FILE"); ok {
+		DB.PasswordFile = v
+	}
+	if v, ok := os.LookupEnv("SS_DATABASE_SSL_MODE"); ok {
+		DB.SSLMode = v
+	}
+	if v, ok := os.LookupEnv("SS_DATABASE_SSL_CA"); ok {
+		DB.SSLCA = v
+	}
+	if v, ok := os.LookupEnv("SS_DATABASE_SSL_CERT"); ok {
+		DB.SSLCert = v
+	}
+	if v, ok := os.LookupEnv("SS_DATABASE_SSL_KEY"); ok {
+		DB.SSLKey = v
+	}
 
 	if DB.Name == "" && os.Getenv("SS_DATABASE_CHOOSE_NAME") != "" {
 		DB.Name = dbChooseName(os.Getenv("SS_DATABASE_CHOOSE_NAME"))
@@ -155,6 +265,15 @@ func setFromSsEnvironmentFile(file string) error {
 		matchFromPhp(str, "SS_DATABASE_SUFFIX")
 	DB.Type = matchFromPhp(str, "SS_DATABASE_CLASS")
 	DB.Port = matchFromPhp(str, "SS_DATABASE_PORT")
+	DB.Socket = matchFromPhp(str, "SS_DATABASE_SOCKET")
+	DB.Charset = matchFromPhp(str, "SS_DATABASE_CHARSET")
+	DB.Path = matchFromPhp(str, "SS_SQLITE_DATABASE_PATH")
+	DB.OptionFile = matchFromPhp(str, "SS_DATABASE_OPTION_FILE")
+	DB.PasswordFile = matchFromPhp(str, "SS_DATABASE_PASSWORD_FILE")
+	DB.SSLMode = matchFromPhp(str, "SS_DATABASE_SSL_MODE")
+	DB.SSLCA = matchFromPhp(str, "SS_DATABASE_SSL_CA")
+	DB.SSLCert = matchFromPhp(str, "SS_DATABASE_SSL_CERT")
+	DB.SSLKey = matchFromPhp(str, "SS_DATABASE_SSL_KEY")
 
 	if DB.Name == "" && matchFromPhp(str, "SS_DATABASE_CHOOSE_NAME") != "" {
 		DB.Name = dbChooseName(matchFromPhp(str, "SS_DATABASE_CHOOSE_NAME"))
@@ -203,8 +322,8 @@ func dbChooseName(v string) string {
 
 	// move up in the folder structure
 	for x := i; x > 0; x-- {
-		f = path.Dir(f)
+		f = filepath.Dir(f)
 	}
 
-	return strings.Replace(fmt.Sprintf("SS_%s", path.Base(f)), ".", "", -1)
+	return strings.Replace(fmt.Sprintf("SS_%s", filepath.Base(f)), ".", "", -1)
 }
@@ -1,14 +1,30 @@
 package app
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 )
 
+// ctx is the context of the running command, cancelled by Interrupt()
+var ctx, cancel = context.WithCancel(context.Background())
+
+// Context returns the context of the running command, which is cancelled when
+// ssbak is interrupted (eg: Ctrl-C) so long operations can stop early
+func Context() context.Context {
+	return ctx
+}
+
+// Interrupt cancels the context of the running command
+func Interrupt() {
+	cancel()
+}
+
 // GetTempDir will create & return a temporary directory if one has not been specified
 func GetTempDir() string {
 	if TempDir == "" {
@@ -50,11 +66,48 @@ func Cleanup() error {
 	return nil
 }
 
-// Log will print out data in verbose output
+// Log will print out data in verbose output, unless quiet
 func Log(msg string) {
-	if Verbose {
-		log.Println(msg)
+	LogToFile("INFO", msg)
+
+	if !Verbose || Quiet {
+		return
+	}
+
+	if LogJSON {
+		jsonLogger.Info(msg, "event", "log")
+		return
+	}
+
+	log.Println(msg)
+}
+
+// jsonLogger writes structured log records to stderr
+var jsonLogger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+// LogEvent logs a structured event with optional key/value fields, eg:
+// LogEvent("dump_completed", "Wrote database.sql.gz", "bytes", 1024). JSON events are
+// always logged, in text mode only the message is logged (in verbose output).
+func LogEvent(event, msg string, fields ...interface{}) {
+	if LogJSON {
+		LogToFile("INFO", msg)
+		jsonLogger.Info(msg, append([]interface{}{"event", event}, fields...)...)
+		return
 	}
+
+	Log(msg)
+}
+
+// LogError logs an error event with JSON logging, else prints the error
+func LogError(err error) {
+	LogToFile("ERROR", err.Error())
+
+	if LogJSON {
+		jsonLogger.Error(err.Error(), "event", "error")
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 }
 
 // MkDirIfNotExists will create a directory if it doesn't exist
@@ -1,7 +1,10 @@
 // Package app handles all the application settings
 package app
 
-import "regexp"
+import (
+	"regexp"
+	"time"
+)
 
 var (
 	// DB config
@@ -10,9 +13,47 @@ var (
 	// ProjectRoot var
 	ProjectRoot string
 
+	// EnvFile runtime variable set with flags, an environment file to read the
+	// database settings from instead of the project .env
+	EnvFile string
+
+	// OptionFile runtime variable set with flags, a MySQL option file with the
+	// database credentials, overriding SS_DATABASE_OPTION_FILE
+	OptionFile string
+
+	// PasswordFile runtime variable set with flags, a file containing the database
+	// password, overriding SS_DATABASE_PASSWORD_FILE
+	PasswordFile string
+
+	// ConnectTimeout runtime variable set with flags, the database connection
+	// timeout in seconds
+	ConnectTimeout = 10
+
+	// MaxAllowedPacket runtime variable set with flags, the largest MySQL statement or
+	// row (in bytes) sent or received by the client, defaults to 256MB
+	MaxAllowedPacket int64 = 256 << 20
+
+	// NetBufferLength runtime variable set with flags, the size (in bytes) of the
+	// multi-row INSERT statements of MySQL dumps, and the initial read buffer of
+	// restores, defaults to 500KB
+	NetBufferLength int64 = 500 << 10
+
+	// RateLimit runtime variable set with flags, the maximum throughput (in bytes per
+	// second) of database dumps & assets archiving, 0 is unlimited
+	RateLimit int64
+
 	// Verbose logging
 	Verbose bool
 
+	// LogJSON runtime variable set with flags, logs structured JSON records to stderr
+	LogJSON bool
+
+	// Quiet runtime variable set with flags, suppresses progress output
+	Quiet bool
+
+	// ProgressBar runtime variable set with flags, displays a restore progress bar
+	ProgressBar bool
+
 	// TempFiles get cleaned up on exit
 	TempFiles []string
 
@@ -28,6 +69,142 @@ var (
 	// IgnoreResampled runtime variable set with flags
 	IgnoreResampled bool
 
+	// CompressionLevel gzip compression level (1-9) runtime variable set with flags,
+	// defaults to 6 (the gzip default)
+	CompressionLevel = 6
+
+	// GzipBlockSize runtime variable set with flags, the size of the blocks compressed
+	// in parallel with gzip, defaults to 1MB
+	GzipBlockSize = 1 << 20
+
+	// GzipWorkers runtime variable set with flags, the number of blocks compressed in
+	// parallel with gzip, 0 uses the number of CPUs
+	GzipWorkers int
+
+	// IncludeRoutines runtime variable set with flags, whether stored routines,
+	// triggers & events are included in MySQL database dumps
+	IncludeRoutines = true
+
+	// Databases runtime variable set with flags, the names of multiple databases to
+	// back up in a single run, using the same connection settings
+	Databases []string
+
+	// MigrateStream runtime variable set with flags, streams MySQL migrations directly
+	// into the target database without an intermediate file
+	MigrateStream bool
+
+	// TableProgress runtime variable set with flags, logs each table as it is dumped
+	TableProgress bool
+
+	// ExcludeTables runtime variable set with flags, table names or glob
+	// patterns (eg: `Cache*`) to exclude from database dumps
+	ExcludeTables []string
+
+	// SchemaOnly runtime variable set with flags, dump the database structure without data
+	SchemaOnly bool
+
+	// DataOnlyTables runtime variable set with flags, only dump the data
+	// (no structure) of these tables
+	DataOnlyTables []string
+
+	// Where runtime variable set with flags, SQL WHERE conditions (by table name)
+	// to filter the rows of MySQL database dumps
+	Where map[string]string
+
+	// HexBlob runtime variable set with flags, dumps MySQL binary & BLOB columns as hex
+	// literals
+	HexBlob bool
+
+	// ExtendedInsert runtime variable set with flags, dumps MySQL rows as multi-row
+	// INSERT statements, else one row per INSERT statement, defaults to true
+	ExtendedInsert = true
+
+	// KeepSQL runtime variable set with flags, also writes the uncompressed SQL of
+	// MySQL dumps to this file
+	KeepSQL string
+
+	// Anonymise runtime variable set with flags, anonymisation strategies (by Table.Column)
+	// for MySQL database dumps
+	Anonymise map[string]string
+
+	// TZUTC runtime variable set with flags, dumps & restores MySQL TIMESTAMP columns
+	// in UTC, defaults to true
+	TZUTC = true
+
+	// DumpRetries runtime variable set with flags, how many times to retry a MySQL
+	// database dump which fails with a transient (connection) error
+	DumpRetries int
+
+	// ExtraDumpArgs runtime variable set with flags, extra arguments for the PostgreSQL
+	// & SQLite dump tools (pg_dump & sqlite3)
+	ExtraDumpArgs []string
+
+	// ExtraRestoreArgs runtime variable set with flags, extra arguments for the
+	// PostgreSQL & SQLite restore tools (psql & sqlite3)
+	ExtraRestoreArgs []string
+
+	// Compat runtime variable set with flags, rewrites incompatible collations on restore
+	Compat bool
+
+	// StripDefiners runtime variable set with flags, removes DEFINER clauses on restore
+	StripDefiners bool
+
+	// LockTables runtime variable set with flags, locks all tables (READ) during
+	// MySQL dumps, for consistent dumps of non-transactional (eg: MyISAM) tables
+	LockTables bool
+
+	// ReplicaSafe runtime variable set with flags, MySQL dumps take no locks & run no
+	// SQL hooks, log the replication status, and warn about tables which are not part of
+	// the consistent snapshot or if replication is stopped
+	ReplicaSafe bool
+
+	// PreDumpSQL runtime variable set with flags, SQL run in the database before it
+	// is dumped
+	PreDumpSQL []string
+
+	// PostRestoreSQL runtime variable set with flags, SQL run in the database after
+	// it is restored
+	PostRestoreSQL []string
+
+	// NoDrop runtime variable set with flags, skips the DROP TABLE & CREATE TABLE
+	// statements on MySQL restores, importing the data into the existing tables
+	NoDrop bool
+
+	// Duplicates runtime variable set with flags, how MySQL restores handle rows with an
+	// existing key: strict (fail), ignore (keep the existing row) or replace (overwrite it)
+	Duplicates = "strict"
+
+	// ForeignKeyChecks runtime variable set with flags, keeps foreign key checks enabled
+	// during MySQL restores
+	ForeignKeyChecks bool
+
+	// MinTables runtime variable set with flags, the minimum number of tables a MySQL
+	// database must contain after a restore, defaults to 1
+	MinTables = 1
+
+	// WaitTimeout runtime variable set with flags, how long to wait for the database
+	// server to accept connections before restoring
+	WaitTimeout = 10 * time.Second
+
+	// Codec database dump compression codec (gzip or zstd) runtime variable set with flags
+	Codec = "gzip"
+
+	// Parallel runtime variable set with flags, the number of connections to dump MySQL tables over
+	Parallel = 1
+
+	// VolumeSize runtime variable set with flags, splits backups into volumes of this size (bytes)
+	VolumeSize int64
+
+	// MinFree runtime variable set with flags, the minimum free space (bytes) to leave
+	// after dumping the database
+	MinFree int64
+
+	// Encrypt runtime variable set with flags, encrypts the database backup
+	Encrypt bool
+
+	// Passphrase used to encrypt & decrypt database backups
+	Passphrase string
+
 	// ResampledRegex regular expressions should match all common thumbnail manipulations except for
 	// resized images as those tend to be linked from HTMLText and aren't auto-generated without a republish
 	ResampledRegex = []*regexp.Regexp{
@@ -56,6 +233,36 @@ type DBStruct struct {
 	// Port database port (as string)
 	Port string
 
+	// Socket database unix socket path, overrides Host & Port
+	Socket string
+
 	// Database type (mysql, postgres etc)
 	Type string
+
+	// Charset MySQL connection character set, defaults to utf8mb4
+	Charset string
+
+	// Path SQLite database directory
+	Path string
+
+	// OptionFile MySQL option file (eg: ~/.my.cnf) with the connection credentials
+	OptionFile string
+
+	// PasswordFile file containing the database password (eg: a Docker secret)
+	PasswordFile string
+
+	// SSLMode database SSL mode (disabled, preferred, required, verify_ca or verify_identity)
+	SSLMode string
+
+	// SSLCA database SSL certificate authority file
+	SSLCA string
+
+	// SSLCert database SSL client certificate file
+	SSLCert string
+
+	// SSLKey database SSL client key file
+	SSLKey string
+
+	// ConnectTimeout how long to wait when connecting to the database server
+	ConnectTimeout time.Duration
 }
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/utils"
+	"github.com/spf13/cobra"
+)
+
+// benchmarkCmd represents the benchmark command
+var benchmarkCmd = &cobra.Command{
+	Use:   "benchmark [<webroot>]",
+	Short: "Compare the compression codecs & levels on the database",
+	Long: `Dump the database of a Silverstripe site once, then compress the dump with each
+compression codec & level, reporting the compressed size & time taken by each.
+
+Use --sample to only compress the start of large dumps.`,
+	Example: `  ssbak benchmark ./
+  ssbak benchmark ./ --sample 100M`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		webroot := "."
+		if len(args) == 1 {
+			webroot = args[0]
+		}
+
+		var sample int64
+		if s, _ := cmd.Flags().GetString("sample"); s != "" {
+			size, err := utils.ParseSize(s)
+			if err != nil {
+				return err
+			}
+			sample = size
+		}
+
+		if err := app.BootstrapEnv(webroot); err != nil {
+			return err
+		}
+
+		db, err := utils.NewDatabase(app.DB)
+		if err != nil {
+			return err
+		}
+
+		sqlFile := filepath.Join(app.GetTempDir(), "database.sql")
+		app.AddTempFile(sqlFile)
+
+		if _, err := utils.BenchmarkDump(db, sqlFile); err != nil {
+			return err
+		}
+
+		results, err := utils.BenchmarkCompression(sqlFile, sample)
+		if err != nil {
+			return err
+		}
+
+		if len(results) > 0 {
+			fmt.Printf("Compressed %s of SQL:\n", utils.ByteToHr(results[0].Bytes))
+		}
+
+		fmt.Printf("%-6s %5s %10s %7s %9s %12s\n", "Codec", "Level", "Size", "Ratio", "Time", "Speed")
+		for _, r := range results {
+			fmt.Printf(
+				"%-6s %5d %10s %6.1fx %8.2fs %10s/s\n",
+				r.Codec, r.Level, utils.ByteToHr(r.CompressedBytes), r.Ratio(), r.Duration.Seconds(), utils.ByteToHr(int64(r.Throughput())),
+			)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(benchmarkCmd)
+
+	benchmarkCmd.Flags().
+		StringP("sample", "", "", "only compress the first part of the dump, eg: 100M (default the whole dump)")
+
+	benchmarkCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
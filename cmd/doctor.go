@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/utils"
+	"github.com/spf13/cobra"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:     "doctor [<webroot>] [<output dir>]",
+	Aliases: []string{"selftest"},
+	Short:   "Check everything needed to back up a site",
+	Long: `Check everything needed to back up a Silverstripe site, without creating a backup:
+the site configuration, the database client (and compression) tools & their server
+compatibility, the database credentials, that the temporary & output directories are
+writable, and that they have enough free space.
+
+Run this to verify a new deployment before relying on scheduled backups.`,
+	Example: `  ssbak doctor ./
+  ssbak doctor ./ /var/backups --codec=xz`,
+	Args: cobra.RangeArgs(0, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		webroot, outDir := ".", "."
+		if len(args) > 0 {
+			webroot = args[0]
+		}
+		if len(args) > 1 {
+			outDir = args[1]
+		}
+
+		if err := utils.ValidateCodec(app.Codec); err != nil {
+			return err
+		}
+
+		checks := utils.Doctor(webroot, outDir)
+
+		failed := 0
+		for _, c := range checks {
+			if c.Passed() {
+				if !app.Quiet {
+					fmt.Printf("[PASS] %s: %s\n", c.Name, c.Detail)
+				}
+				continue
+			}
+			if c.Skipped() {
+				fmt.Printf("[SKIP] %s\n", c.Name)
+				continue
+			}
+			failed++
+			fmt.Printf("[FAIL] %s: %s\n", c.Name, c.Err.Error())
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+		}
+
+		if !app.Quiet {
+			fmt.Printf("All %d checks passed\n", len(checks))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().
+		StringVarP(&app.Codec, "codec", "", "gzip", "check the tools of this compression codec are installed (gzip, zstd, bzip2, xz or none)")
+
+	doctorCmd.Flags().
+		DurationVarP(&app.WaitTimeout, "wait", "", 10*time.Second, "wait for the database server to accept connections (MySQL)")
+
+	doctorCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
@@ -3,8 +3,8 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"path"
 	"path/filepath"
+	"time"
 
 	"github.com/axllent/ssbak/app"
 	"github.com/axllent/ssbak/utils"
@@ -13,13 +13,19 @@ import (
 
 // loadCmd represents the load command
 var loadCmd = &cobra.Command{
-	Use:     "load <sspak> [<webroot>]",
-	Short:   "Restore database and/or assets from .sspak backup",
-	Long:    `Restore an .sspak file for a Silverstripe site. Deletes existing table data & assets so be careful!`,
-	Example: `  ssbak load website.sspak`,
-	Args:    cobra.RangeArgs(1, 2),
+	Use:   "load <sspak> [<webroot>]",
+	Short: "Restore database and/or assets from .sspak backup",
+	Long: `Restore an .sspak file for a Silverstripe site. Deletes existing table data & assets so be careful!
+
+A database dump (eg: database.sql or database.sql.gz) can also be restored directly.
+Use "-" as the sspak file to read the archive from stdin. Its contents are still
+extracted to the temporary directory before being restored.`,
+	Example: `  ssbak load website.sspak
+  ssbak load database.sql
+  ssh user@host "cat website.sspak" | ssbak load -`,
+	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if !utils.IsFile(args[0]) {
+		if !utils.BackupExists(args[0]) {
 			return fmt.Errorf("'%s' does not exist", args[0])
 		}
 
@@ -27,42 +33,127 @@ var loadCmd = &cobra.Command{
 			return errors.New("You cannot use --assets and --db flags together")
 		}
 
+		if err := utils.ValidateDuplicates(app.Duplicates); err != nil {
+			return err
+		}
+
+		if dropDB, _ := cmd.Flags().GetBool("drop-db"); dropDB && app.NoDrop {
+			return errors.New("You cannot use --drop-db and --no-drop flags together")
+		}
+
 		app.ProjectRoot = "."
 		if len(args) == 2 {
 			app.ProjectRoot = args[1]
 		}
 
 		var assetsBase string
-		if utils.IsDir(path.Join(app.ProjectRoot, "public")) {
-			assetsBase = path.Join(app.ProjectRoot, "public")
+		if utils.IsDir(filepath.Join(app.ProjectRoot, "public")) {
+			assetsBase = filepath.Join(app.ProjectRoot, "public")
 		} else {
 			assetsBase = app.ProjectRoot
 		}
 
 		tmpDir := app.GetTempDir()
 
-		if err := utils.ExtractSSPak(args[0], tmpDir); err != nil {
-			return err
+		gzipSQLFile := filepath.Join(tmpDir, "database.sql.gz")
+
+		// a database dump (eg: database.sql or database.sql.gz from another tool) is
+		// restored directly, compressed or not
+		if utils.IsFile(args[0]) && !utils.IsSSPak(args[0]) {
+			if app.OnlyAssets {
+				return fmt.Errorf("'%s' is not an sspak archive, so contains no assets", args[0])
+			}
+			app.Log(fmt.Sprintf("Restoring database dump '%s'", args[0]))
+			gzipSQLFile = args[0]
+		} else {
+			if err := utils.ExtractSSPak(args[0], tmpDir); err != nil {
+				return err
+			}
+			app.AddTempFile(gzipSQLFile)
 		}
 
-		gzipSQLFile := filepath.Join(tmpDir, "database.sql.gz")
-		app.AddTempFile(gzipSQLFile)
 		assetsFile := filepath.Join(tmpDir, "assets.tar.gz")
 		app.AddTempFile(assetsFile)
+		manifestFile := filepath.Join(tmpDir, utils.ManifestFile)
+		app.AddTempFile(manifestFile)
+
+		// backups created by older versions (or other tools) have no manifest
+		var manifest utils.Manifest
+		if utils.IsFile(manifestFile) {
+			m, err := utils.ReadManifest(manifestFile)
+			if err != nil {
+				fmt.Printf("Warning: %s\n", err.Error())
+			} else {
+				manifest = m
+				if !app.Quiet {
+					fmt.Println(manifest.Summary())
+				}
+			}
+		}
 
 		if utils.IsFile(gzipSQLFile) && !app.OnlyAssets {
 			if err := app.BootstrapEnv(app.ProjectRoot); err != nil {
 				return err
 			}
 
+			if err := manifest.CheckDatabase(app.DB.Type); err != nil {
+				return err
+			}
+
+			if app.NoDrop && app.DB.Type != "MySQL" {
+				return errors.New("--no-drop is only supported for MySQL databases")
+			}
+
+			if app.Duplicates != "strict" && app.DB.Type != "MySQL" {
+				return errors.New("--duplicates is only supported for MySQL databases")
+			}
+
+			if len(app.ExtraRestoreArgs) > 0 && app.DB.Type == "MySQL" {
+				return errors.New("--extra-restore-arg is not supported for MySQL, which is restored without the mysql client")
+			}
+
+			conf := app.DB
+			target, _ := cmd.Flags().GetString("database")
+			if target != "" && target != conf.Name {
+				app.Log(fmt.Sprintf("Restoring to database '%s' instead of '%s'", target, conf.Name))
+				conf.Name = target
+			}
+
+			db, err := utils.NewDatabase(conf)
+			if err != nil {
+				return err
+			}
+
+			// restoring into another database requires it to exist, unless it is created
+			if conf.Name != app.DB.Name {
+				if createDB, _ := cmd.Flags().GetBool("create-db"); !createDB {
+					if err := db.TestConnection(); err != nil {
+						return fmt.Errorf("%s (use --create-db to create it)", err.Error())
+					}
+				}
+			}
+
+			if err := utils.CheckPassphrase(gzipSQLFile); err != nil {
+				return err
+			}
+
 			dropDatabase, _ := cmd.Flags().GetBool("drop-db")
-			// use map to determine which database function to use
-			if err := utils.DBCreateWrapper[app.DB.Type](dropDatabase); err != nil {
+			if dropDatabase {
+				yes, _ := cmd.Flags().GetBool("yes")
+				if err := utils.ConfirmDropDatabase(conf.Name, yes); err != nil {
+					return err
+				}
+			}
+
+			if err := db.CreateDB(dropDatabase); err != nil {
+				return err
+			}
+
+			if _, err := db.LoadFromGz(gzipSQLFile); err != nil {
 				return err
 			}
 
-			// use map to determine which database function to use
-			if err := utils.DBLoadWrapper[app.DB.Type](gzipSQLFile); err != nil {
+			if err := utils.RunSQLHook(db, "post-restore", app.PostRestoreSQL); err != nil {
 				return err
 			}
 		}
@@ -81,7 +172,16 @@ func init() {
 	rootCmd.AddCommand(loadCmd)
 
 	loadCmd.Flags().
-		BoolP("drop-db", "", false, "drop existing database (if exists)")
+		BoolP("drop-db", "", false, "drop existing database (if exists), asking to confirm when run in a terminal")
+
+	loadCmd.Flags().
+		BoolP("yes", "y", false, "drop the database without asking to confirm")
+
+	loadCmd.Flags().
+		StringP("database", "", "", "restore to this database instead of the configured one")
+
+	loadCmd.Flags().
+		BoolP("create-db", "", false, "create the --database database if it does not exist")
 
 	loadCmd.Flags().
 		BoolVarP(&app.OnlyDB, "db", "", false, "only restore the database")
@@ -94,4 +194,34 @@ func init() {
 
 	loadCmd.Flags().
 		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+
+	loadCmd.Flags().
+		DurationVarP(&app.WaitTimeout, "wait", "", 10*time.Second, "wait for the database server to accept connections (MySQL)")
+
+	loadCmd.Flags().
+		BoolVarP(&app.Compat, "compat", "", false, "rewrite MySQL 8 collations for older MySQL & MariaDB servers")
+
+	loadCmd.Flags().
+		StringArrayVarP(&app.ExtraRestoreArgs, "extra-restore-arg", "", []string{}, "extra argument for psql or sqlite3, repeatable, eg: --extra-restore-arg=--single-transaction (use with care)")
+
+	loadCmd.Flags().
+		BoolVarP(&app.NoDrop, "no-drop", "", false, "merge into the existing MySQL tables, skipping the DROP TABLE & CREATE TABLE statements (the tables must exist with a matching schema)")
+
+	loadCmd.Flags().
+		StringVarP(&app.Duplicates, "duplicates", "", "strict", "how MySQL rows with an existing key are restored: strict (fail), ignore (keep the existing row) or replace (overwrite it)")
+
+	loadCmd.Flags().
+		BoolVarP(&app.ForeignKeyChecks, "foreign-key-checks", "", false, "keep foreign key checks enabled during MySQL restores (tables must be restored in dependency order)")
+
+	loadCmd.Flags().
+		IntVarP(&app.MinTables, "min-tables", "", 1, "fail if the MySQL database contains fewer tables after the restore (0 to disable)")
+
+	loadCmd.Flags().
+		BoolVarP(&app.StripDefiners, "strip-definers", "", false, "remove DEFINER clauses from MySQL routines, triggers, events & views, so they are created as the restoring user")
+
+	loadCmd.Flags().
+		StringArrayVarP(&app.PostRestoreSQL, "post-restore-sql", "", []string{}, "SQL to run in the database after it is restored, repeatable, eg: --post-restore-sql=\"UPDATE SiteConfig SET Title = 'Staging'\"")
+
+	loadCmd.Flags().
+		BoolVarP(&app.ProgressBar, "progress", "p", false, "display database restore progress & ETA")
 }
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/utils"
+	"github.com/spf13/cobra"
+)
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate <webroot>",
+	Short: "Copy the database to another server or database",
+	Long: `Copy the database of a Silverstripe site to another server and/or database,
+eg: to refresh a staging database from production.
+
+The target connection uses the site's database settings, overridden by the --to-* flags.
+Set the target password with $SSBAK_TO_PASSWORD rather than --to-password, as
+command line arguments are visible to other users (eg: with ps).`,
+	Example: `  ssbak migrate ./ --to-host=staging-db --to-database=site_staging --drop-db
+  ssbak migrate ./ --to-database=site_copy`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := app.BootstrapEnv(args[0]); err != nil {
+			return err
+		}
+
+		src := app.DB
+		dst := app.DB
+
+		targets := map[string]*string{
+			"to-host":     &dst.Host,
+			"to-port":     &dst.Port,
+			"to-socket":   &dst.Socket,
+			"to-user":     &dst.Username,
+			"to-password": &dst.Password,
+			"to-database": &dst.Name,
+		}
+		changed := false
+		for flag, field := range targets {
+			if cmd.Flags().Changed(flag) {
+				*field, _ = cmd.Flags().GetString(flag)
+				changed = true
+			} else if flag == "to-password" && os.Getenv("SSBAK_TO_PASSWORD") != "" {
+				*field = os.Getenv("SSBAK_TO_PASSWORD")
+				changed = true
+			}
+		}
+		if !changed {
+			return errors.New("No target given, use the --to-* flags")
+		}
+
+		if cmd.Flags().Changed("to-host") && !cmd.Flags().Changed("to-socket") {
+			// a socket overrides the host, so is not inherited by another host
+			dst.Socket = ""
+		}
+
+		if app.MigrateStream && !cmd.Flags().Changed("codec") {
+			// compressing the stream only costs CPU, as it is never written to disk
+			app.Codec = "none"
+		}
+		if err := utils.ValidateCodec(app.Codec); err != nil {
+			return err
+		}
+
+		dropDatabase, _ := cmd.Flags().GetBool("drop-db")
+		if dropDatabase {
+			yes, _ := cmd.Flags().GetBool("yes")
+			if err := utils.ConfirmDropDatabase(dst.Name, yes); err != nil {
+				return err
+			}
+		}
+
+		result, err := utils.Migrate(src, dst, app.GetTempDir(), dropDatabase)
+		if err != nil {
+			return err
+		}
+
+		if !app.Quiet {
+			fmt.Printf(
+				"Migrated database '%s' to '%s' (%s in %s)\n",
+				src.Name, result.Database, utils.ByteToHr(result.Bytes), result.Duration.Round(time.Millisecond),
+			)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+
+	migrateCmd.Flags().
+		StringP("to-host", "", "", "target database host")
+
+	migrateCmd.Flags().
+		StringP("to-port", "", "", "target database port")
+
+	migrateCmd.Flags().
+		StringP("to-socket", "", "", "target MySQL unix socket")
+
+	migrateCmd.Flags().
+		StringP("to-user", "", "", "target database user")
+
+	migrateCmd.Flags().
+		StringP("to-password", "", "", "target database password, visible to other users in the process list (use $SSBAK_TO_PASSWORD instead)")
+
+	migrateCmd.Flags().
+		StringP("to-database", "", "", "target database name")
+
+	migrateCmd.Flags().
+		BoolP("drop-db", "", false, "drop the target database (if exists), asking to confirm when run in a terminal")
+
+	migrateCmd.Flags().
+		BoolP("yes", "y", false, "drop the target database without asking to confirm")
+
+	migrateCmd.Flags().
+		BoolVarP(&app.MigrateStream, "stream", "", false, "stream the dump directly into the target database without a temporary file (MySQL)")
+
+	migrateCmd.Flags().
+		StringVarP(&app.Codec, "codec", "", "gzip", "compression codec of the dump (gzip, zstd, bzip2, xz or none), with --stream the default is none")
+
+	migrateCmd.Flags().
+		BoolVarP(&app.Compat, "compat", "", false, "rewrite MySQL 8 collations for older MySQL & MariaDB servers (automatic for MariaDB targets)")
+
+	migrateCmd.Flags().
+		DurationVarP(&app.WaitTimeout, "wait", "", 10*time.Second, "wait for the target database server to accept connections (MySQL)")
+
+	migrateCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
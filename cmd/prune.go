@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/utils"
+	"github.com/spf13/cobra"
+)
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune <dir>",
+	Short: "Delete old .sspak backups, keeping the newest",
+	Long: `Delete all but the newest .sspak backups in a directory (by modification time).
+
+Only .sspak archives (including split volumes) and their checksum files are deleted,
+any other files in the directory are left untouched.`,
+	Example: `  ssbak prune /backups --keep 7`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keep, _ := cmd.Flags().GetInt("keep")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		deleted, err := utils.PruneBackups(args[0], keep, dryRun)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range deleted {
+			if dryRun {
+				fmt.Printf("Would delete %s\n", f)
+			} else if !app.Quiet {
+				fmt.Printf("Deleted %s\n", f)
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+
+	pruneCmd.Flags().
+		IntP("keep", "k", 7, "number of backups to keep")
+
+	pruneCmd.Flags().
+		BoolP("dry-run", "n", false, "show which backups would be deleted without deleting them")
+
+	pruneCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
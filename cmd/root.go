@@ -2,15 +2,39 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/utils"
 	"github.com/spf13/cobra"
 )
 
+const (
+	// interruptTimeout is how long the running command has to stop once interrupted
+	interruptTimeout = 10 * time.Second
+
+	// interruptedExitCode is the exit code when interrupted (128 + SIGINT)
+	interruptedExitCode = 130
+)
+
+var (
+	// logFormat is set with the --log-format flag
+	logFormat string
+
+	// logFile & logFileMaxSize are set with the --log-file & --log-file-max-size flags
+	logFile, logFileMaxSize string
+
+	// maxAllowedPacket & netBufferLength are set with the --max-allowed-packet &
+	// --net-buffer-length flags
+	maxAllowedPacket, netBufferLength string
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "ssbak",
@@ -21,7 +45,57 @@ Support/Documentation
   https://github.com/axllent/ssbak`,
 	SilenceUsage:  true, // suppress help screen on error
 	SilenceErrors: true, // suppress duplicate error on error
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		switch logFormat {
+		case "text":
+		case "json":
+			app.LogJSON = true
+		default:
+			return fmt.Errorf("Invalid log format '%s' (text or json)", logFormat)
+		}
+
+		packet, err := utils.ParseSize(maxAllowedPacket)
+		if err != nil {
+			return err
+		}
+		// the MySQL limit is 1GB
+		if packet < 1024 || packet > 1<<30 {
+			return errors.New("--max-allowed-packet must be between 1K and 1G")
+		}
+		app.MaxAllowedPacket = packet
+
+		buffer, err := utils.ParseSize(netBufferLength)
+		if err != nil {
+			return err
+		}
+		if buffer > app.MaxAllowedPacket && !cmd.Flags().Changed("net-buffer-length") {
+			// the default is lowered with --max-allowed-packet
+			buffer = app.MaxAllowedPacket
+		}
+		if buffer < 1024 || buffer > app.MaxAllowedPacket {
+			return errors.New("--net-buffer-length must be between 1K and the --max-allowed-packet size")
+		}
+		app.NetBufferLength = buffer
+
+		if logFile != "" {
+			// 0 never rotates the log file
+			var maxSize int64
+			if strings.TrimSpace(logFileMaxSize) != "0" {
+				maxSize, err = utils.ParseSize(logFileMaxSize)
+				if err != nil {
+					return err
+				}
+			}
+			if err := app.OpenLogFile(logFile, maxSize); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
 	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+		app.LogToFile("INFO", "Completed successfully")
+
 		// delete temporary files after completion
 		return app.Cleanup()
 	},
@@ -38,7 +112,14 @@ func Execute() {
 	}
 
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Printf("Error: %v\n", err)
+		if app.Context().Err() != nil {
+			// interrupted, see init()
+			app.LogToFile("ERROR", "Interrupted")
+			app.Cleanup() // #nosec
+			os.Exit(interruptedExitCode)
+		}
+
+		app.LogError(err)
 
 		// Clean up temporary files on error, don't print any cleanup errors
 		// as they would have already been returned above
@@ -54,30 +135,73 @@ func Execute() {
 			}
 		}
 
-		fmt.Println(help)
+		if !app.LogJSON && !app.Quiet {
+			fmt.Fprintln(os.Stderr, help)
+		}
 
-		os.Exit(1)
+		os.Exit(utils.ExitCode(err))
 	}
 }
 
 func init() {
+	rootCmd.PersistentFlags().
+		BoolVarP(&app.Quiet, "quiet", "q", false, "only output errors & warnings, no progress or informational output (eg: for cron jobs)")
+
+	rootCmd.PersistentFlags().
+		StringVarP(&logFormat, "log-format", "", "text", "log format, text or json (structured records on stderr)")
+
+	rootCmd.PersistentFlags().
+		StringVarP(&logFile, "log-file", "", os.Getenv("SSBAK_LOG_FILE"), "append timestamped log messages & errors to this file (default $SSBAK_LOG_FILE)")
+
+	rootCmd.PersistentFlags().
+		StringVarP(&logFileMaxSize, "log-file-max-size", "", "10M", "rotate the log file to <log-file>.1 once larger than this size (0 to never rotate)")
+
+	rootCmd.PersistentFlags().
+		StringVarP(&app.EnvFile, "env-file", "", "", "read the database settings from this environment file instead of the project .env (supports DB_HOST, DB_PORT, DB_USER, DB_PASSWORD & DB_NAME)")
+
+	rootCmd.PersistentFlags().
+		IntVarP(&app.ConnectTimeout, "connect-timeout", "", 10, "database connection timeout in seconds")
+
+	rootCmd.PersistentFlags().
+		StringVarP(&maxAllowedPacket, "max-allowed-packet", "", "256M", "the largest MySQL statement or row sent or received, eg: for large BLOBs")
+
+	rootCmd.PersistentFlags().
+		StringVarP(&netBufferLength, "net-buffer-length", "", "500K", "the size of the multi-row INSERT statements of MySQL dumps, and the restore read buffer")
+
+	rootCmd.PersistentFlags().
+		StringVarP(&app.PasswordFile, "password-file", "", "", "read the database password from a file, eg: a Docker or Kubernetes secret")
+
+	rootCmd.PersistentFlags().
+		StringVarP(&app.OptionFile, "defaults-extra-file", "", "", "read the MySQL credentials (host, port, socket, user & password) from an option file, eg: ~/.my.cnf")
+
 	// hide the `help` command
 	rootCmd.SetHelpCommand(&cobra.Command{
 		Hidden: true,
 	})
 
-	// Clean up temporary files on cancel
-	sigs := make(chan os.Signal, 1)
+	// Cancel the running command on interrupt, which then removes its partial files
+	// & exits (see Execute()). If it does not stop in time, or on a second signal,
+	// temporary & partial files are cleaned up here instead.
+	sigs := make(chan os.Signal, 2)
 	signal.Notify(sigs,
 		syscall.SIGHUP,
 		syscall.SIGINT,
 		syscall.SIGTERM,
 		syscall.SIGQUIT)
 	go func() {
-		<-sigs
+		sig := <-sigs
+		fmt.Fprintf(os.Stderr, "\nReceived %s, cancelling\n", sig)
+		app.Interrupt()
+
+		select {
+		case <-sigs:
+		case <-time.After(interruptTimeout):
+		}
+
+		app.LogToFile("ERROR", "Interrupted")
 		if err := app.Cleanup(); err != nil {
-			fmt.Printf("Error: %v\n", err)
+			app.LogError(err)
 		}
-		os.Exit(0)
+		os.Exit(interruptedExitCode)
 	}()
 }
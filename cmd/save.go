@@ -2,7 +2,11 @@ package cmd
 
 import (
 	"errors"
-	"path"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/axllent/ssbak/app"
 	"github.com/axllent/ssbak/utils"
@@ -11,12 +15,22 @@ import (
 
 // saveCmd represents the save command
 var saveCmd = &cobra.Command{
-	Use:     "save <webroot> <sspak>",
-	Short:   "Create .sspak backup of database and/or assets",
-	Long:    `Create .sspak archive from a Silverstripe database and/or assets.`,
-	Example: `  ssbak save ./ website.sspak`,
-	Args:    cobra.ExactArgs(2),
+	Use:   "save <webroot> [<sspak>]",
+	Short: "Create .sspak backup of database and/or assets",
+	Long: `Create .sspak archive from a Silverstripe database and/or assets.
+
+If no sspak file is given, a timestamped filename is used (see --filename-format).
+Use "-" as the sspak file to write the archive to stdout.`,
+	Example: `  ssbak save ./ website.sspak
+  ssbak save ./ - | ssh user@host "cat > website.sspak"`,
+	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 2 {
+			if err := utils.RedirectStdout(args[1]); err != nil {
+				return err
+			}
+		}
+
 		if err := app.BootstrapEnv(args[0]); err != nil {
 			return err
 		}
@@ -25,33 +39,226 @@ var saveCmd = &cobra.Command{
 			return errors.New("You cannot use --assets and --db flags together")
 		}
 
+		if len(app.DataOnlyTables) > 0 && (app.SchemaOnly || app.OnlyAssets) {
+			return errors.New("You cannot use --data-only with --schema-only or --assets")
+		}
+
+		if pairs, _ := cmd.Flags().GetStringArray("where"); len(pairs) > 0 {
+			where, err := utils.ParseWhere(pairs)
+			if err != nil {
+				return err
+			}
+			if app.DB.Type != "MySQL" || app.SchemaOnly || app.OnlyAssets {
+				return errors.New("--where is only supported for MySQL backups with data")
+			}
+			for table := range where {
+				if len(app.DataOnlyTables) > 0 && !utils.InSlice(table, app.DataOnlyTables) {
+					return fmt.Errorf("--where table '%s' is not one of the --data-only tables", table)
+				}
+			}
+			app.Where = where
+		}
+
+		if pairs, _ := cmd.Flags().GetStringArray("anonymise"); len(pairs) > 0 {
+			rules, err := utils.ParseAnonymise(pairs)
+			if err != nil {
+				return err
+			}
+			if app.DB.Type != "MySQL" || app.SchemaOnly || app.OnlyAssets {
+				return errors.New("--anonymise is only supported for MySQL backups with data")
+			}
+			app.Anonymise = rules
+		}
+
+		skipExtendedInsert, _ := cmd.Flags().GetBool("skip-extended-insert")
+		if skipExtendedInsert {
+			if cmd.Flags().Changed("extended-insert") && app.ExtendedInsert {
+				return errors.New("You cannot use --extended-insert and --skip-extended-insert flags together")
+			}
+			app.ExtendedInsert = false
+		}
+		if !app.ExtendedInsert && (app.DB.Type != "MySQL" || app.OnlyAssets) {
+			return errors.New("--skip-extended-insert is only supported for MySQL backups")
+		}
+
+		if app.KeepSQL != "" {
+			if app.DB.Type != "MySQL" || app.OnlyAssets {
+				return errors.New("--keep-sql is only supported for MySQL backups")
+			}
+			if app.Parallel > 1 || len(app.Databases) > 0 {
+				return errors.New("--keep-sql cannot be used with --parallel or --databases")
+			}
+			if app.Encrypt {
+				// the kept SQL would not be encrypted
+				return errors.New("You cannot use --keep-sql and --encrypt flags together")
+			}
+		}
+
+		if app.HexBlob && (app.DB.Type != "MySQL" || app.OnlyAssets) {
+			return errors.New("--hex-blob is only supported for MySQL backups")
+		}
+
+		if len(app.ExtraDumpArgs) > 0 && app.DB.Type == "MySQL" && !app.OnlyAssets {
+			return errors.New("--extra-dump-arg is not supported for MySQL, which is dumped without mysqldump")
+		}
+
+		if err := utils.ValidateCompressionLevel(app.CompressionLevel); err != nil {
+			return err
+		}
+
+		if blockSize, _ := cmd.Flags().GetString("gzip-block-size"); blockSize != "" {
+			size, err := utils.ParseSize(blockSize)
+			if err != nil {
+				return err
+			}
+			app.GzipBlockSize = int(size)
+		}
+
+		if rateLimit, _ := cmd.Flags().GetString("rate-limit"); rateLimit != "" {
+			rate, err := utils.ParseRate(rateLimit)
+			if err != nil {
+				return err
+			}
+			app.RateLimit = rate
+		}
+
+		if volumeSize, _ := cmd.Flags().GetString("volume-size"); volumeSize != "" {
+			size, err := utils.ParseSize(volumeSize)
+			if err != nil {
+				return err
+			}
+			app.VolumeSize = size
+		}
+
+		if minFree, _ := cmd.Flags().GetString("min-free"); minFree != "" {
+			size, err := utils.ParseSize(minFree)
+			if err != nil {
+				return err
+			}
+			app.MinFree = size
+		}
+
+		if err := utils.ValidateCodec(app.Codec); err != nil {
+			return err
+		}
+
+		if app.Parallel < 1 {
+			return errors.New("--parallel must be at least 1")
+		}
+
+		if app.Parallel > 1 && (app.DB.Type != "MySQL" || app.SchemaOnly || len(app.DataOnlyTables) > 0 || len(app.Where) > 0) {
+			return errors.New("--parallel is only supported for full MySQL backups (without --where)")
+		}
+
+		if app.Parallel > 1 {
+			// stderr, as the archive may be written to stdout
+			fmt.Fprintf(os.Stderr, "Warning: with --parallel each connection dumps its tables in its own transaction, so the backup is not a consistent snapshot across tables\n")
+		}
+
+		if app.ReplicaSafe {
+			if app.LockTables {
+				return errors.New("You cannot use --replica-safe and --lock-tables flags together")
+			}
+			if len(app.PreDumpSQL) > 0 {
+				return errors.New("You cannot use --replica-safe and --pre-dump-sql flags together")
+			}
+			app.Log("Replica-safe: dumping in a read-only transaction, without table locks or replication statements")
+		}
+
+		if app.LockTables && (app.DB.Type != "MySQL" || app.Parallel > 1 || app.SchemaOnly || len(app.DataOnlyTables) > 0 || len(app.Where) > 0) {
+			return errors.New("--lock-tables is only supported for full MySQL backups (without --parallel, --schema-only, --data-only or --where)")
+		}
+
+		if app.Encrypt && !app.OnlyAssets {
+			if err := utils.ReadPassphrase(true); err != nil {
+				return err
+			}
+		}
+
+		skipRoutines, _ := cmd.Flags().GetBool("skip-routines")
+		app.IncludeRoutines = !skipRoutines
+
+		if len(app.Databases) > 0 {
+			if len(args) == 2 {
+				return errors.New("You cannot give an sspak file with --databases, use --filename-format instead")
+			}
+			if app.OnlyAssets {
+				return errors.New("You cannot use --databases with --assets")
+			}
+			format, _ := cmd.Flags().GetString("filename-format")
+			if !strings.Contains(format, "{name}") {
+				return errors.New("--filename-format must include {name} with --databases")
+			}
+			force, _ := cmd.Flags().GetBool("force")
+
+			return saveDatabases(format, force)
+		}
+
+		sspakFile := ""
+		if len(args) == 2 {
+			sspakFile = args[1]
+		} else {
+			format, _ := cmd.Flags().GetString("filename-format")
+			sspakFile = utils.BackupFilename(format, app.DB.Name, time.Now())
+			if !app.Quiet {
+				fmt.Printf("Saving to %s\n", sspakFile)
+			}
+		}
+
+		force, _ := cmd.Flags().GetBool("force")
+		if !force && sspakFile != "-" && utils.BackupExists(sspakFile) {
+			return fmt.Errorf("'%s' already exists, use --force to overwrite it", sspakFile)
+		}
+		if !force && app.KeepSQL != "" && utils.IsFile(app.KeepSQL) {
+			return fmt.Errorf("'%s' already exists, use --force to overwrite it", app.KeepSQL)
+		}
+
 		tmpDir := app.GetTempDir()
 
 		sspakFiles := []string{}
 
+		var dump *utils.DumpResult
+
 		if !app.OnlyAssets {
-			gzipFile := path.Join(tmpDir, "database.sql.gz")
+			gzipFile := filepath.Join(tmpDir, "database.sql.gz")
 			app.AddTempFile(gzipFile)
 
-			// use map to determine which database function to use
-			if err := utils.DBDumpWrapper[app.DB.Type](gzipFile); err != nil {
+			db, err := utils.NewDatabase(app.DB)
+			if err != nil {
 				return err
 			}
 
+			if err := utils.RunSQLHook(db, "pre-dump", app.PreDumpSQL); err != nil {
+				return err
+			}
+
+			result, err := db.DumpToGz(gzipFile)
+			if err != nil {
+				return err
+			}
+			dump = &result
+
+			if result.SQLFile != "" && !app.Quiet {
+				fmt.Printf(
+					"Kept uncompressed SQL '%s' (%s, %s compressed)\n",
+					result.SQLFile, utils.ByteToHr(result.SQLBytes), utils.ByteToHr(result.Bytes),
+				)
+			}
+
 			sspakFiles = append(sspakFiles, gzipFile)
 		}
 
 		if !app.OnlyDB {
 			var assetsDir string
 
-			if utils.IsDir(path.Join(app.ProjectRoot, "assets")) {
-				assetsDir = app.RealPath(path.Join(app.ProjectRoot, "assets"))
-			} else if utils.IsDir(path.Join(app.ProjectRoot, "public", "assets")) {
-				assetsDir = app.RealPath(path.Join(app.ProjectRoot, "public", "assets"))
+			if utils.IsDir(filepath.Join(app.ProjectRoot, "assets")) {
+				assetsDir = app.RealPath(filepath.Join(app.ProjectRoot, "assets"))
+			} else if utils.IsDir(filepath.Join(app.ProjectRoot, "public", "assets")) {
+				assetsDir = app.RealPath(filepath.Join(app.ProjectRoot, "public", "assets"))
 			} else {
 				return errors.New("Could not locate assets directory")
 			}
-			assetsFile := path.Join(tmpDir, "assets.tar.gz")
+			assetsFile := filepath.Join(tmpDir, "assets.tar.gz")
 			app.AddTempFile(assetsFile)
 
 			if err := utils.AssetsToTarGz(assetsDir, assetsFile); err != nil {
@@ -61,10 +268,96 @@ var saveCmd = &cobra.Command{
 			sspakFiles = append(sspakFiles, assetsFile)
 		}
 
-		return utils.CreateSSPak(args[1], sspakFiles)
+		manifest, err := utils.BuildManifest(Version, dump, sspakFiles)
+		if err != nil {
+			return err
+		}
+		manifestFile := filepath.Join(tmpDir, utils.ManifestFile)
+		app.AddTempFile(manifestFile)
+		if err := utils.WriteManifest(manifest, manifestFile); err != nil {
+			return err
+		}
+
+		// the manifest is added last, as other tools expect the database or assets first
+		sspakFiles = append(sspakFiles, manifestFile)
+
+		return utils.CreateSSPak(sspakFile, sspakFiles)
 	},
 }
 
+// SaveDatabases saves each of app.Databases into its own (database only) sspak file,
+// printing a summary of the backups once all are done
+func saveDatabases(format string, force bool) error {
+	now := time.Now()
+
+	sspakFiles := map[string]string{}
+	for _, name := range app.Databases {
+		sspakFile := utils.BackupFilename(format, name, now)
+		if !force && utils.BackupExists(sspakFile) {
+			return fmt.Errorf("'%s' already exists, use --force to overwrite it", sspakFile)
+		}
+		sspakFiles[name] = sspakFile
+	}
+
+	tmpDir := app.GetTempDir()
+
+	dumps, err := utils.DumpAll(app.DB, app.Databases, tmpDir)
+	errs := []error{}
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	saved := 0
+	for i, dump := range dumps {
+		if dump.Err != nil {
+			continue
+		}
+
+		gzipFile := filepath.Join(tmpDir, "database.sql.gz")
+		app.AddTempFile(gzipFile)
+		if err := os.Rename(dump.Result.Path, gzipFile); err != nil {
+			dumps[i].Err = err
+			errs = append(errs, fmt.Errorf("Error saving database '%s': %s", dump.Name, err.Error()))
+			continue
+		}
+
+		if err := saveDatabase(&dump.Result, gzipFile, sspakFiles[dump.Name]); err != nil {
+			dumps[i].Err = err
+			errs = append(errs, fmt.Errorf("Error saving database '%s': %s", dump.Name, err.Error()))
+			continue
+		}
+		saved++
+	}
+
+	if !app.Quiet || len(errs) > 0 {
+		fmt.Printf("Saved %d of %d databases:\n", saved, len(dumps))
+		for _, dump := range dumps {
+			if dump.Err != nil {
+				fmt.Printf("  %s: failed\n", dump.Name)
+			} else {
+				fmt.Printf("  %s: %s (%s)\n", dump.Name, sspakFiles[dump.Name], dump.Result)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// SaveDatabase creates a database only sspak file from a database dump
+func saveDatabase(dump *utils.DumpResult, gzipFile, sspakFile string) error {
+	manifest, err := utils.BuildManifest(Version, dump, []string{gzipFile})
+	if err != nil {
+		return err
+	}
+	manifestFile := filepath.Join(app.GetTempDir(), utils.ManifestFile)
+	app.AddTempFile(manifestFile)
+	if err := utils.WriteManifest(manifest, manifestFile); err != nil {
+		return err
+	}
+
+	return utils.CreateSSPak(sspakFile, []string{gzipFile, manifestFile})
+}
+
 func init() {
 	rootCmd.AddCommand(saveCmd)
 
@@ -77,6 +370,93 @@ func init() {
 	saveCmd.Flags().
 		BoolVarP(&app.IgnoreResampled, "ignore-resampled", "i", false, "ignore most resampled images (experimental)")
 
+	saveCmd.Flags().
+		IntVarP(&app.CompressionLevel, "compression-level", "", 6, "gzip compression level (1-9)")
+
+	saveCmd.Flags().
+		StringP("gzip-block-size", "", "1M", "size of the blocks compressed in parallel with gzip")
+
+	saveCmd.Flags().
+		StringP("rate-limit", "", "", "limit the throughput of database dumps & assets archiving to reduce the I/O impact on the server, eg: 50MB/s")
+
+	saveCmd.Flags().
+		IntVarP(&app.GzipWorkers, "gzip-workers", "", 0, "number of blocks compressed in parallel with gzip (default number of CPUs)")
+
+	saveCmd.Flags().
+		BoolP("skip-routines", "", false, "do not save stored routines, triggers & events (MySQL)")
+
+	saveCmd.Flags().
+		StringSliceVarP(&app.Databases, "databases", "", []string{}, "save these databases (with the same connection settings) into separate sspak files, comma-separated or repeated")
+
+	saveCmd.Flags().
+		StringSliceVarP(&app.ExcludeTables, "exclude-table", "", []string{}, "exclude database tables, comma-separated or repeated (supports globs, eg: 'Cache*')")
+
+	saveCmd.Flags().
+		BoolVarP(&app.SchemaOnly, "schema-only", "", false, "only save the database structure, without any data")
+
+	saveCmd.Flags().
+		StringSliceVarP(&app.DataOnlyTables, "data-only", "", []string{}, "only save the data (no structure) of these database tables, comma-separated or repeated")
+
+	saveCmd.Flags().
+		StringArrayP("where", "", []string{}, "only save the rows of a MySQL table matching a condition, repeatable, eg: \"LoginAttempt:Created > '2024-01-01'\"")
+
+	saveCmd.Flags().
+		StringArrayVarP(&app.PreDumpSQL, "pre-dump-sql", "", []string{}, "SQL to run in the database before it is dumped, repeatable, eg: --pre-dump-sql=\"TRUNCATE TABLE SessionCache\"")
+
+	saveCmd.Flags().
+		BoolVarP(&app.ExtendedInsert, "extended-insert", "", true, "dump MySQL rows as multi-row INSERT statements of up to --net-buffer-length, which restore fastest")
+
+	saveCmd.Flags().
+		BoolP("skip-extended-insert", "", false, "dump MySQL rows as one INSERT statement per row, eg: to diff dumps or keep them in git (slower to restore)")
+
+	saveCmd.Flags().
+		StringVarP(&app.KeepSQL, "keep-sql", "", "", "also save the uncompressed SQL of the MySQL dump to a file, eg: --keep-sql=database.sql (not encrypted)")
+
+	saveCmd.Flags().
+		BoolVarP(&app.HexBlob, "hex-blob", "", false, "dump MySQL binary & BLOB columns as hex literals, which restore byte for byte regardless of charset (doubles their uncompressed size)")
+
+	saveCmd.Flags().
+		StringArrayP("anonymise", "", []string{}, "anonymise a MySQL column with null, email or const:<value>, repeatable, eg: Member.Email=email")
+
+	saveCmd.Flags().
+		StringArrayVarP(&app.ExtraDumpArgs, "extra-dump-arg", "", []string{}, "extra argument for pg_dump or sqlite3, repeatable, eg: --extra-dump-arg=--no-comments (use with care)")
+
+	saveCmd.Flags().
+		BoolVarP(&app.LockTables, "lock-tables", "", false, "lock all MySQL tables for reading (on a separate connection) during the dump, for consistent backups of MyISAM tables (blocks writes)")
+
+	saveCmd.Flags().
+		BoolVarP(&app.ReplicaSafe, "replica-safe", "", false, "ensure the MySQL dump takes no locks & writes nothing, eg: on a read replica, log the replication status, and warn about tables outside the snapshot or stopped replication (fails with --lock-tables or --pre-dump-sql)")
+
+	saveCmd.Flags().
+		IntVarP(&app.Parallel, "parallel", "", 1, "number of connections to dump MySQL tables over in parallel")
+
+	saveCmd.Flags().
+		BoolVarP(&app.TZUTC, "tz-utc", "", true, "dump MySQL TIMESTAMP columns in UTC, so they are restored unchanged regardless of the server time zones")
+
+	saveCmd.Flags().
+		IntVarP(&app.DumpRetries, "retries", "", 0, "retry a MySQL database dump this many times if it fails with a connection error")
+
+	saveCmd.Flags().
+		StringVarP(&app.Codec, "codec", "", "gzip", "database compression codec (gzip, zstd, bzip2, xz or none for uncompressed SQL)")
+
+	saveCmd.Flags().
+		BoolVarP(&app.Encrypt, "encrypt", "", false, "encrypt the database backup with a passphrase (read from $"+utils.PassphraseEnv+" or prompted for)")
+
+	saveCmd.Flags().
+		StringP("volume-size", "", "", "split the backup into volumes of this size, eg: 2G (website.sspak.001, website.sspak.002 etc)")
+
+	saveCmd.Flags().
+		StringP("min-free", "", "", "abort if less than this much space would be free after the database dump, eg: 5G")
+
+	saveCmd.Flags().
+		StringP("filename-format", "", "{name}-{date}-{time}.sspak", "filename format if no sspak file is given ({name} = database name, {date} = YYYYMMDD, {time} = HHMM)")
+
+	saveCmd.Flags().
+		BoolP("force", "f", false, "overwrite an existing sspak file")
+
+	saveCmd.Flags().
+		BoolVarP(&app.TableProgress, "table-progress", "", false, "log each table (with its size & duration) as it is dumped, with --verbose (MySQL & PostgreSQL)")
+
 	saveCmd.Flags().
 		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
 }
@@ -3,7 +3,6 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"path"
 	"path/filepath"
 
 	"github.com/axllent/ssbak/app"
@@ -19,6 +18,10 @@ var saveexistingCmd = &cobra.Command{
 	Example: `  ssbak saveexisting website.sspak --db="database.sql" --assets="public/assets"`,
 	Args:    cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := utils.RedirectStdout(args[0]); err != nil {
+			return err
+		}
+
 		sqlFile, _ := cmd.Flags().GetString("db")
 		assetsDir, _ := cmd.Flags().GetString("assets")
 
@@ -26,6 +29,10 @@ var saveexistingCmd = &cobra.Command{
 			return errors.New("You must specify either --db or --assets, or both")
 		}
 
+		if force, _ := cmd.Flags().GetBool("force"); !force && args[0] != "-" && utils.BackupExists(args[0]) {
+			return fmt.Errorf("'%s' already exists, use --force to overwrite it", args[0])
+		}
+
 		if sqlFile != "" && !utils.IsFile(sqlFile) {
 			return fmt.Errorf("Database file '%s' does not exist", sqlFile)
 		}
@@ -34,6 +41,26 @@ var saveexistingCmd = &cobra.Command{
 			return fmt.Errorf("Assets directory '%s' does not exist", assetsDir)
 		}
 
+		if err := utils.ValidateCompressionLevel(app.CompressionLevel); err != nil {
+			return err
+		}
+
+		if blockSize, _ := cmd.Flags().GetString("gzip-block-size"); blockSize != "" {
+			size, err := utils.ParseSize(blockSize)
+			if err != nil {
+				return err
+			}
+			app.GzipBlockSize = int(size)
+		}
+
+		if volumeSize, _ := cmd.Flags().GetString("volume-size"); volumeSize != "" {
+			size, err := utils.ParseSize(volumeSize)
+			if err != nil {
+				return err
+			}
+			app.VolumeSize = size
+		}
+
 		tmpDir := app.GetTempDir()
 
 		sspakFiles := []string{}
@@ -45,11 +72,15 @@ var saveexistingCmd = &cobra.Command{
 			if err := utils.GzipFile(sqlFile, gzipSQL); err != nil {
 				return err
 			}
+
+			if err := utils.VerifyGzip(gzipSQL); err != nil {
+				return err
+			}
 			sspakFiles = append(sspakFiles, gzipSQL)
 		}
 
 		if assetsDir != "" {
-			assetsFile := path.Join(tmpDir, "assets.tar.gz")
+			assetsFile := filepath.Join(tmpDir, "assets.tar.gz")
 			app.AddTempFile(assetsFile)
 
 			if err := utils.AssetsToTarGz(assetsDir, assetsFile); err != nil {
@@ -72,6 +103,21 @@ func init() {
 	saveexistingCmd.Flags().
 		StringP("assets", "", "", "add an existing assets directory")
 
+	saveexistingCmd.Flags().
+		IntVarP(&app.CompressionLevel, "compression-level", "", 6, "gzip compression level (1-9)")
+
+	saveexistingCmd.Flags().
+		StringP("gzip-block-size", "", "1M", "size of the blocks compressed in parallel with gzip")
+
+	saveexistingCmd.Flags().
+		IntVarP(&app.GzipWorkers, "gzip-workers", "", 0, "number of blocks compressed in parallel with gzip (default number of CPUs)")
+
+	saveexistingCmd.Flags().
+		StringP("volume-size", "", "", "split the backup into volumes of this size, eg: 2G (website.sspak.001, website.sspak.002 etc)")
+
+	saveexistingCmd.Flags().
+		BoolP("force", "f", false, "overwrite an existing sspak file")
+
 	saveexistingCmd.Flags().
 		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
 }
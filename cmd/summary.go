@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/utils"
+	"github.com/spf13/cobra"
+)
+
+// summaryCmd represents the summary command
+var summaryCmd = &cobra.Command{
+	Use:   "summary <sspak|sql.gz>",
+	Short: "Summarise the database of a backup without restoring it",
+	Long: `Display the database name, server version, charset, tables & approximate row counts
+of an .sspak backup or compressed SQL dump, without restoring it.
+
+Use "-" to read the backup from stdin.`,
+	Example: `  ssbak summary website.sspak
+  ssbak summary database.sql.gz`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !utils.BackupExists(args[0]) {
+			return fmt.Errorf("'%s' does not exist", args[0])
+		}
+
+		summary, err := utils.InspectBackup(args[0])
+		if err != nil {
+			return err
+		}
+
+		if summary.Truncated {
+			fmt.Println("Warning: the backup is incomplete, only the part which could be read is summarised")
+		}
+
+		if summary.Database != "" {
+			fmt.Printf("Database:       %s\n", summary.Database)
+		}
+		if summary.ServerVersion != "" {
+			fmt.Printf("Server version: %s\n", summary.ServerVersion)
+		}
+		if summary.Charset != "" {
+			fmt.Printf("Charset:        %s\n", summary.Charset)
+		}
+		if summary.SchemaOnly {
+			fmt.Println("Schema only:    yes (no table data)")
+		}
+		fmt.Printf("SQL size:       %s\n", utils.ByteToHr(summary.Bytes))
+		fmt.Printf("Tables:         %d (~%d rows)\n", len(summary.Tables), summary.Rows())
+
+		width := 0
+		for _, t := range summary.Tables {
+			if len(t.Name) > width {
+				width = len(t.Name)
+			}
+		}
+
+		for _, t := range summary.Tables {
+			fmt.Printf("  %-*s  %d\n", width, t.Name, t.Rows)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(summaryCmd)
+
+	summaryCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/utils"
+	"github.com/spf13/cobra"
+)
+
+// testCmd represents the test command
+var testCmd = &cobra.Command{
+	Use:     "test [<webroot>]",
+	Short:   "Test the database connection",
+	Long:    `Test the database credentials of a Silverstripe site, checking the server can be connected to and the database exists.`,
+	Example: `  ssbak test ./`,
+	Args:    cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		webroot := "."
+		if len(args) == 1 {
+			webroot = args[0]
+		}
+
+		if err := app.BootstrapEnv(webroot); err != nil {
+			return err
+		}
+
+		db, err := utils.NewDatabase(app.DB)
+		if err != nil {
+			return err
+		}
+
+		if err := db.TestConnection(); err != nil {
+			return err
+		}
+
+		if !app.Quiet {
+			fmt.Printf("Successfully connected to %s database '%s'\n", app.DB.Type, app.DB.Name)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(testCmd)
+
+	testCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/utils"
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify <sspak> [<webroot>]",
+	Short: "Verify the checksum of a .sspak backup",
+	Long: `Verify an .sspak backup against the .sha256 checksum file written alongside it when it was created.
+
+With --restore the database is also restored into a temporary database on the site's
+MySQL server, which is dropped afterwards, without touching the site's database.`,
+	Example: `  ssbak verify website.sspak
+  ssbak verify website.sspak ./ --restore`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		restore, _ := cmd.Flags().GetBool("restore")
+
+		// the checksum is optional when the restore is verified
+		if !restore || utils.ChecksumExists(args[0]) {
+			if err := utils.VerifyChecksum(args[0]); err != nil {
+				return err
+			}
+
+			if !app.Quiet {
+				fmt.Printf("Checksum OK: %s\n", args[0])
+			}
+		}
+
+		if !restore {
+			return nil
+		}
+
+		webroot := "."
+		if len(args) == 2 {
+			webroot = args[1]
+		}
+
+		tmpDir := app.GetTempDir()
+		gzipSQLFile := filepath.Join(tmpDir, "database.sql.gz")
+
+		if utils.IsFile(args[0]) && !utils.IsSSPak(args[0]) {
+			gzipSQLFile = args[0]
+		} else {
+			app.OnlyDB = true
+			if err := utils.ExtractSSPak(args[0], tmpDir); err != nil {
+				return err
+			}
+			app.AddTempFile(gzipSQLFile)
+			app.AddTempFile(filepath.Join(tmpDir, utils.ManifestFile))
+		}
+
+		if !utils.IsFile(gzipSQLFile) {
+			return fmt.Errorf("'%s' does not contain a database", args[0])
+		}
+
+		if err := app.BootstrapEnv(webroot); err != nil {
+			return err
+		}
+
+		if err := utils.CheckPassphrase(gzipSQLFile); err != nil {
+			return err
+		}
+
+		result, err := utils.VerifyBackup(app.DB, gzipSQLFile)
+		if err != nil {
+			return fmt.Errorf("Restore failed: %s", err.Error())
+		}
+
+		if !app.Quiet {
+			fmt.Printf(
+				"Restore OK: %d tables & %d rows restored (%s in %s)\n",
+				result.Tables, result.Rows, utils.ByteToHr(result.Bytes), result.Duration.Round(time.Millisecond),
+			)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().
+		BoolP("restore", "", false, "also restore the database into a temporary MySQL database, which is then dropped")
+
+	verifyCmd.Flags().
+		DurationVarP(&app.WaitTimeout, "wait", "", 10*time.Second, "wait for the database server to accept connections (MySQL)")
+
+	verifyCmd.Flags().
+		BoolVarP(&app.Compat, "compat", "", false, "rewrite MySQL 8 collations for older MySQL & MariaDB servers")
+
+	verifyCmd.Flags().
+		IntVarP(&app.MinTables, "min-tables", "", 1, "fail if the restored MySQL database contains fewer tables (0 to disable)")
+
+	verifyCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
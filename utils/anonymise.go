@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/aliakseiz/go-mysqldump"
+	"github.com/axllent/ssbak/app"
+)
+
+// Columns are anonymised (and binary columns hex-encoded with --hex-blob) by rewriting
+// the INSERT statements as the dump streams through. Every INSERT statement is written
+// on a single line (newlines within values are escaped), in the form:
+// INSERT INTO `Table` VALUES (...),(...);
+
+// hexStrategy is the strategy of binary columns dumped as hex literals
+const hexStrategy = "hex"
+
+var anonymiseRegex = regexp.MustCompile(`^([^.\x60]+)\.([^.\x60]+)=(null|email|const:.*)$`)
+
+// ParseAnonymise parses Table.Column=strategy pairs into a map of "Table.Column" to
+// anonymisation strategies, where the strategy is `null`, `email` (a unique fake email
+// address) or `const:<value>` (a constant value)
+func ParseAnonymise(pairs []string) (map[string]string, error) {
+	rules := map[string]string{}
+	for _, pair := range pairs {
+		matches := anonymiseRegex.FindStringSubmatch(strings.TrimSpace(pair))
+		if len(matches) != 4 {
+			return nil, fmt.Errorf("Invalid --anonymise '%s' (expected Table.Column=null, Table.Column=email or Table.Column=const:value)", pair)
+		}
+		rules[matches[1]+"."+matches[2]] = matches[3]
+	}
+
+	return rules, nil
+}
+
+// AnonymiseColumns returns the anonymisation strategies of each table by column
+// position (including the binary columns with --hex-blob), returning an error if
+// any of the columns do not exist
+func anonymiseColumns(db *sql.DB) (map[string]map[int]string, error) {
+	columns := map[string]map[int]string{}
+
+	if app.HexBlob {
+		if err := hexColumns(db, columns); err != nil {
+			return nil, err
+		}
+	}
+
+	for column, strategy := range app.Anonymise {
+		parts := strings.SplitN(column, ".", 2)
+
+		var position int
+		err := db.QueryRow(
+			"SELECT ORDINAL_POSITION FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+			parts[0], parts[1],
+		).Scan(&position)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("Column '%s' does not exist", column)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if columns[parts[0]] == nil {
+			columns[parts[0]] = map[int]string{}
+		}
+		columns[parts[0]][position-1] = strategy
+	}
+
+	return columns, nil
+}
+
+// AnonymiseWriter rewrites the anonymised columns of INSERT statements written to it
+type anonymiseWriter struct {
+	w       io.Writer
+	columns map[string]map[int]string
+	rows    map[string]int
+	buf     bytes.Buffer
+}
+
+// NewAnonymiseWriter returns a writer anonymising the INSERT statements of the given
+// table columns (see anonymiseColumns). Close() must be called to write the last line.
+func newAnonymiseWriter(w io.Writer, columns map[string]map[int]string) *anonymiseWriter {
+	return &anonymiseWriter{w: w, columns: columns, rows: map[string]int{}}
+}
+
+func (aw *anonymiseWriter) Write(p []byte) (int, error) {
+	if len(aw.columns) == 0 {
+		return aw.w.Write(p)
+	}
+
+	aw.buf.Write(p)
+
+	for {
+		i := bytes.IndexByte(aw.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+
+		line := aw.buf.Next(i + 1)
+		if err := aw.writeLine(line); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// Close writes any remaining (unterminated) line
+func (aw *anonymiseWriter) Close() error {
+	if aw.buf.Len() == 0 {
+		return nil
+	}
+
+	return aw.writeLine(aw.buf.Next(aw.buf.Len()))
+}
+
+func (aw *anonymiseWriter) writeLine(line []byte) error {
+	if bytes.HasPrefix(line, []byte("INSERT INTO `")) {
+		for table, columns := range aw.columns {
+			prefix := "INSERT INTO `" + table + "` VALUES "
+			if !bytes.HasPrefix(line, []byte(prefix)) {
+				continue
+			}
+
+			values, err := aw.anonymise(table, string(line[len(prefix):]), columns)
+			if err != nil {
+				return fmt.Errorf("Error anonymising '%s': %s", table, err.Error())
+			}
+
+			_, err = io.WriteString(aw.w, prefix+values)
+			return err
+		}
+	}
+
+	_, err := aw.w.Write(line)
+
+	return err
+}
+
+// Anonymise replaces the anonymised columns of a list of rows, eg: (1,'a'),(2,'b');
+// String values are quoted with backslash escapes, so commas & parentheses within
+// quotes are skipped.
+func (aw *anonymiseWriter) anonymise(table, values string, columns map[int]string) (string, error) {
+	var out strings.Builder
+
+	inRow := false
+	inQuote := false
+	column := 0
+	start := 0
+
+	for i := 0; i < len(values); i++ {
+		c := values[i]
+
+		if inQuote {
+			if c == '\\' {
+				i++
+			} else if c == '\'' {
+				inQuote = false
+			}
+			continue
+		}
+
+		switch {
+		case !inRow && c == '(':
+			inRow = true
+			column = 0
+			start = i + 1
+			aw.rows[table]++
+			out.WriteByte(c)
+		case !inRow:
+			out.WriteByte(c)
+		case c == '\'':
+			inQuote = true
+		case c == ',' || c == ')':
+			value := values[start:i]
+			if strategy, ok := columns[column]; ok {
+				if strategy == hexStrategy {
+					value = hexValue(value)
+				} else {
+					value = anonymisedValue(strategy, aw.rows[table])
+				}
+			}
+			out.WriteString(value)
+			out.WriteByte(c)
+			column++
+			start = i + 1
+			if c == ')' {
+				inRow = false
+			}
+		}
+	}
+
+	if inRow || inQuote {
+		return "", fmt.Errorf("unterminated row in INSERT statement")
+	}
+
+	return out.String(), nil
+}
+
+// AnonymisedValue returns the SQL value of an anonymisation strategy for the nth row
+func anonymisedValue(strategy string, n int) string {
+	switch {
+	case strategy == "null":
+		return "NULL"
+	case strategy == "email":
+		return fmt.Sprintf("'user%d@example.com'", n)
+	default:
+		return "'" + mysqldump.Sanitize(strings.TrimPrefix(strategy, "const:")) + "'"
+	}
+}
+
+// HexColumns adds the binary & BLOB columns of every table to columns, to be dumped
+// as hex literals
+func hexColumns(db *sql.DB, columns map[string]map[int]string) error {
+	rows, err := db.Query(
+		"SELECT TABLE_NAME, ORDINAL_POSITION FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() " +
+			"AND DATA_TYPE IN ('binary', 'varbinary', 'tinyblob', 'blob', 'mediumblob', 'longblob')",
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var table string
+		var position int
+		if err := rows.Scan(&table, &position); err != nil {
+			return err
+		}
+		if columns[table] == nil {
+			columns[table] = map[int]string{}
+		}
+		columns[table][position-1] = hexStrategy
+		n++
+	}
+
+	app.Log(fmt.Sprintf("Dumping %d binary columns as hex", n))
+
+	return rows.Err()
+}
+
+// HexValue returns a dumped SQL value (eg: 'a\'b' or _binary 'a\'b') as a hex
+// literal, eg: X'612762'. NULL is unchanged.
+func hexValue(value string) string {
+	value = strings.TrimPrefix(value, "_binary ")
+	if len(value) < 2 || value[0] != '\'' || value[len(value)-1] != '\'' {
+		return value
+	}
+
+	return "X'" + hex.EncodeToString(unescapeSQL(value[1:len(value)-1])) + "'"
+}
+
+// SQLUnescapes are the characters of the backslash escapes written by mysqldump.Sanitize
+var sqlUnescapes = map[byte]byte{'0': 0, 'b': '\b', 'n': '\n', 'r': '\r', 'Z': 0x1a}
+
+// UnescapeSQL returns the bytes of a backslash escaped SQL string
+func unescapeSQL(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			i++
+			c = s[i]
+			if u, ok := sqlUnescapes[c]; ok {
+				c = u
+			}
+		}
+		b = append(b, c)
+	}
+
+	return b
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseAnonymise(t *testing.T) {
+	tests := []struct {
+		pair     string
+		column   string
+		strategy string
+		err      bool
+	}{
+		{"Member.Email=email", "Member.Email", "email", false},
+		{" Member.Surname=null ", "Member.Surname", "null", false},
+		{"Member.FirstName=const:Jo Bloggs", "Member.FirstName", "const:Jo Bloggs", false},
+		{"Member.Notes=const:", "Member.Notes", "const:", false},
+		{"Member.Email=fake", "", "", true},
+		{"Email=email", "", "", true},
+		{"db.Member.Email=email", "", "", true},
+		{"`Member`.Email=email", "", "", true},
+	}
+
+	for _, tt := range tests {
+		rules, err := ParseAnonymise([]string{tt.pair})
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseAnonymise(%q) returned no error", tt.pair)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAnonymise(%q) returned error: %s", tt.pair, err)
+			continue
+		}
+		if rules[tt.column] != tt.strategy {
+			t.Errorf("ParseAnonymise(%q) = %v, want %s=%s", tt.pair, rules, tt.column, tt.strategy)
+		}
+	}
+}
+
+func TestAnonymiseWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns map[int]string
+		in      string
+		want    string
+	}{
+		{
+			"email",
+			map[int]string{1: "email"},
+			"INSERT INTO `Member` VALUES (1,'a@b.com'),(2,'c@d.com');\n",
+			"INSERT INTO `Member` VALUES (1,'user1@example.com'),(2,'user2@example.com');\n",
+		},
+		{
+			"quoted commas & parentheses",
+			map[int]string{2: "null"},
+			"INSERT INTO `Member` VALUES (1,'Smith, (Jo)','secret');\n",
+			"INSERT INTO `Member` VALUES (1,'Smith, (Jo)',NULL);\n",
+		},
+		{
+			"escaped quotes & backslashes",
+			map[int]string{0: "null"},
+			"INSERT INTO `Member` VALUES ('it\\'s','a\\\\',''),('\\\\\\'',',)','x');\n",
+			"INSERT INTO `Member` VALUES (NULL,'a\\\\',''),(NULL,',)','x');\n",
+		},
+		{
+			"constant is escaped",
+			map[int]string{1: "const:O'Brien"},
+			"INSERT INTO `Member` VALUES (1,'Smith');\n",
+			"INSERT INTO `Member` VALUES (1,'O\\'Brien');\n",
+		},
+		{
+			"binary as hex",
+			map[int]string{1: hexStrategy},
+			"INSERT INTO `Member` VALUES (1,_binary 'a\\'b\\0'),(2,NULL),(3,'');\n",
+			"INSERT INTO `Member` VALUES (1,X'61276200'),(2,NULL),(3,X'');\n",
+		},
+		{
+			"other tables & statements are unchanged",
+			map[int]string{0: "null"},
+			"INSERT INTO `MemberPassword` VALUES (1,'a');\nDROP TABLE IF EXISTS `Member`;\n",
+			"INSERT INTO `MemberPassword` VALUES (1,'a');\nDROP TABLE IF EXISTS `Member`;\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		aw := newAnonymiseWriter(&out, map[string]map[int]string{"Member": tt.columns})
+
+		// written in two parts to split the statement across writes
+		half := len(tt.in) / 2
+		if _, err := aw.Write([]byte(tt.in[:half])); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if _, err := aw.Write([]byte(tt.in[half:])); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if err := aw.Close(); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		if out.String() != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, out.String(), tt.want)
+		}
+	}
+}
+
+func TestAnonymiseWriterUnterminated(t *testing.T) {
+	var out bytes.Buffer
+	aw := newAnonymiseWriter(&out, map[string]map[int]string{"Member": {0: "null"}})
+
+	if _, err := aw.Write([]byte("INSERT INTO `Member` VALUES (1,'abc);\n")); err == nil {
+		t.Error("unterminated quote returned no error")
+	}
+}
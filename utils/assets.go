@@ -4,7 +4,6 @@ package utils
 import (
 	"fmt"
 	"os"
-	"path"
 	"path/filepath"
 
 	"github.com/axllent/ssbak/app"
@@ -17,7 +16,7 @@ func AssetsToTarGz(assetsDir, gzipFile string) error {
 	size, _ := CalcSize(assetsDir)
 	app.Log(fmt.Sprintf("Compressing '%s' (%s) to '%s'", assetsDir, ByteToHr(size), gzipFile))
 
-	if err := HasEnoughSpace(path.Dir(gzipFile), size); err != nil {
+	if err := HasEnoughSpace(filepath.Dir(gzipFile), size); err != nil {
 		return err
 	}
 
@@ -28,7 +27,7 @@ func AssetsToTarGz(assetsDir, gzipFile string) error {
 	err := TarGZCompress(assetsDir, gzipFile)
 
 	outSize, _ := CalcSize(gzipFile)
-	app.Log(fmt.Sprintf("Wrote '%s' (%s)", gzipFile, ByteToHr(outSize)))
+	app.LogEvent("assets_completed", fmt.Sprintf("Wrote '%s' (%s)", gzipFile, ByteToHr(outSize)), "file", gzipFile, "bytes", outSize)
 
 	return err
 }
@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// Backups (sspak files) can be a local file, the volumes of a split backup
+// (website.sspak.001, website.sspak.002 etc), an S3 object (s3://bucket/key),
+// a remote file over SFTP (sftp://user@host/path), or "-" to write to stdout
+// or read from stdin.
+
+// Stdout is the original stdout, which console output is redirected away from
+// when writing a backup to stdout
+var stdout = os.Stdout
+
+// IsStdio returns whether a backup path is "-" (stdout when saving, stdin when restoring)
+func isStdio(file string) bool {
+	return file == "-"
+}
+
+// RedirectStdout redirects all console output to stderr when writing a backup to
+// stdout, so messages cannot corrupt the backup stream
+func RedirectStdout(file string) error {
+	if !isStdio(file) {
+		return nil
+	}
+
+	if isTerminal(stdout) {
+		return errors.New("Refusing to write a backup to a terminal, redirect or pipe the output instead")
+	}
+
+	os.Stdout = os.Stderr
+
+	return nil
+}
+
+// IsRemote returns whether a backup path is an S3 or SFTP URL
+func isRemote(file string) bool {
+	return isS3(file) || isSFTP(file)
+}
+
+// BackupExists returns whether a backup file, the volumes of a split backup,
+// or a remote backup exist
+func BackupExists(file string) bool {
+	if isStdio(file) {
+		return true
+	}
+
+	if isRemote(file) {
+		_, err := backupSize(file)
+		return err == nil
+	}
+
+	return IsFile(backupBase(file)) || len(backupVolumes(file)) > 0
+}
+
+// BackupSize returns the total size of a backup
+func backupSize(file string) (int64, error) {
+	if isStdio(file) {
+		return 0, errors.New("Unknown size of stdin")
+	}
+
+	if isS3(file) {
+		return s3Size(file)
+	}
+
+	if isSFTP(file) {
+		return sftpSize(file)
+	}
+
+	volumes := backupVolumes(file)
+	if volumes == nil {
+		return CalcSize(backupBase(file))
+	}
+
+	var size int64
+	for _, v := range volumes {
+		s, err := CalcSize(v)
+		if err != nil {
+			return 0, err
+		}
+		size = size + s
+	}
+
+	return size, nil
+}
+
+// OpenBackup opens a backup for reading, joining all the volumes of a split
+// backup into a single stream
+func openBackup(file string) (io.ReadCloser, error) {
+	if isStdio(file) {
+		// stdin is only read sequentially, and is not closed. The archive is extracted
+		// from it like any other, so its files are still written to the temporary dir
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+
+	if isS3(file) {
+		return openS3(file)
+	}
+
+	if isSFTP(file) {
+		return openSFTP(file)
+	}
+
+	volumes := backupVolumes(file)
+	if volumes == nil {
+		return os.Open(filepath.Clean(backupBase(file)))
+	}
+
+	if len(volumes) == 0 {
+		return nil, fmt.Errorf("'%s' does not exist", file)
+	}
+
+	app.Log(fmt.Sprintf("Reading %d volumes of '%s'", len(volumes), backupBase(file)))
+
+	return &volumeReader{volumes: volumes}, nil
+}
+
+// BackupWriter writes a backup, which only replaces any existing backup of the
+// same name once Commit() succeeds. Abort() discards the backup, and is a no-op
+// once committed, so it can be deferred to clean up after any errors.
+type backupWriter interface {
+	io.Writer
+	Commit() error
+	Abort()
+}
+
+// CreateBackup creates a backup for writing, split into volumes if app.VolumeSize
+// is set
+func createBackup(file string) (backupWriter, error) {
+	if isStdio(file) {
+		if app.VolumeSize > 0 {
+			return nil, errors.New("Volumes are not supported when writing to stdout")
+		}
+		return stdoutWriter{}, nil
+	}
+
+	if isRemote(file) {
+		if app.VolumeSize > 0 {
+			return nil, errors.New("Volumes are not supported for remote backups")
+		}
+		return createRemote(file)
+	}
+
+	if app.VolumeSize > 0 {
+		return newVolumeWriter(file, app.VolumeSize), nil
+	}
+
+	f, err := os.Create(filepath.Clean(file + ".tmp"))
+	if err != nil {
+		return nil, fmt.Errorf("Could not create '%s': %s", file, err.Error())
+	}
+
+	// removed if interrupted, a no-op once renamed
+	app.AddTempFile(f.Name())
+
+	return &fileWriter{File: f, file: file}, nil
+}
+
+// CreateRemote creates a remote (S3 or SFTP) file for writing
+func createRemote(file string) (backupWriter, error) {
+	if isS3(file) {
+		return newS3Writer(file)
+	}
+
+	return newSFTPWriter(file)
+}
+
+// FileWriter writes a local backup to a temporary file, which is renamed once committed
+type fileWriter struct {
+	*os.File
+	file string
+	done bool
+}
+
+// Commit closes & renames the temporary file, removing the volumes of any
+// previous split backup of the same name
+func (fw *fileWriter) Commit() error {
+	fw.done = true
+	if err := syncClose(fw.File); err != nil {
+		os.Remove(fw.File.Name()) // #nosec
+		return err
+	}
+
+	if err := os.Rename(fw.File.Name(), fw.file); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(fw.file))
+
+	for n := 1; IsFile(volumeName(fw.file, n)); n++ {
+		if err := os.Remove(volumeName(fw.file, n)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Abort closes & removes the temporary file
+func (fw *fileWriter) Abort() {
+	if fw.done {
+		return
+	}
+	fw.done = true
+	fw.File.Close()           // #nosec
+	os.Remove(fw.File.Name()) // #nosec
+}
+
+// StdoutWriter writes a backup to stdout
+type stdoutWriter struct{}
+
+func (stdoutWriter) Write(p []byte) (int, error) {
+	return stdout.Write(p)
+}
+
+// Commit is a no-op, stdout is not closed
+func (stdoutWriter) Commit() error {
+	return nil
+}
+
+// Abort is a no-op, anything already written cannot be discarded
+func (stdoutWriter) Abort() {}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// The database is dumped once (uncompressed) to a temporary file, which is then
+// compressed with each codec & level in turn, discarding the compressed output.
+
+// BenchmarkCodec is a compression codec & level to benchmark
+type BenchmarkCodec struct {
+	Codec string
+	Level int
+}
+
+// BenchmarkCodecs are the codecs & levels benchmarked
+var BenchmarkCodecs = []BenchmarkCodec{
+	{"gzip", 1},
+	{"gzip", 6},
+	{"gzip", 9},
+	{"zstd", 1},
+	{"zstd", 3},
+	{"zstd", 9},
+}
+
+// BenchmarkResult is the compressed size & duration of a codec & level
+type BenchmarkResult struct {
+	BenchmarkCodec
+
+	// Bytes is the size of the uncompressed SQL
+	Bytes int64
+
+	// CompressedBytes is the size of the compressed SQL
+	CompressedBytes int64
+
+	// Duration is how long the compression took
+	Duration time.Duration
+}
+
+// Ratio returns the compression ratio, eg: 8.5 for 85MB compressed to 10MB
+func (r BenchmarkResult) Ratio() float64 {
+	if r.CompressedBytes == 0 {
+		return 0
+	}
+
+	return float64(r.Bytes) / float64(r.CompressedBytes)
+}
+
+// Throughput returns the uncompressed bytes compressed per second
+func (r BenchmarkResult) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+
+	return float64(r.Bytes) / r.Duration.Seconds()
+}
+
+// BenchmarkDump dumps the database uncompressed into sqlFile, for BenchmarkCompression
+func BenchmarkDump(db Database, sqlFile string) (DumpResult, error) {
+	codec, encrypt := app.Codec, app.Encrypt
+	defer func() { app.Codec, app.Encrypt = codec, encrypt }()
+
+	app.Codec = "none"
+	app.Encrypt = false
+
+	return db.DumpToGz(sqlFile)
+}
+
+// BenchmarkCompression compresses (up to sample bytes of) an uncompressed SQL file
+// with each of the BenchmarkCodecs. A sample of 0 compresses the whole file.
+func BenchmarkCompression(sqlFile string, sample int64) ([]BenchmarkResult, error) {
+	codec, level := app.Codec, app.CompressionLevel
+	defer func() { app.Codec, app.CompressionLevel = codec, level }()
+
+	results := []BenchmarkResult{}
+
+	for _, c := range BenchmarkCodecs {
+		app.Codec = c.Codec
+		app.CompressionLevel = c.Level
+
+		result, err := benchmarkCodec(sqlFile, sample)
+		if err != nil {
+			return results, fmt.Errorf("Error benchmarking %s level %d: %s", c.Codec, c.Level, err.Error())
+		}
+		result.BenchmarkCodec = c
+
+		app.Log(fmt.Sprintf("Compressed with %s level %d in %s", c.Codec, c.Level, result.Duration.Round(time.Millisecond)))
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// BenchmarkCodec compresses a SQL file with the configured codec & level
+func benchmarkCodec(sqlFile string, sample int64) (BenchmarkResult, error) {
+	f, err := os.Open(filepath.Clean(sqlFile))
+	if err != nil {
+		return BenchmarkResult{}, err
+	}
+
+	defer f.Close() // #nosec
+
+	var in io.Reader = f
+	if sample > 0 {
+		in = io.LimitReader(f, sample)
+	}
+
+	// the compressed size, counted without logging progress
+	counter := &progressCounter{}
+
+	start := time.Now()
+
+	cw, err := newCodecWriter(&progressWriter{ioutil.Discard, counter})
+	if err != nil {
+		return BenchmarkResult{}, err
+	}
+
+	n, err := io.Copy(cw, in)
+	if err != nil {
+		return BenchmarkResult{}, err
+	}
+
+	if err := cw.Close(); err != nil {
+		return BenchmarkResult{}, err
+	}
+
+	return BenchmarkResult{Bytes: n, CompressedBytes: counter.bytes, Duration: time.Since(start)}, nil
+}
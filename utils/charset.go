@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// MySQL dumps record the source database's default character set & collation in
+// their header, eg: `-- Database charset	utf8mb4 utf8mb4_general_ci`, which is
+// applied to the target database on restore.
+const charsetPrefix = "-- Database charset"
+
+var charsetNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// DetectCharset returns the default character set & collation of the current database.
+func detectCharset(db *sql.DB) (string, string, error) {
+	var charset, collation string
+	err := db.QueryRow("SELECT @@character_set_database, @@collation_database").Scan(&charset, &collation)
+
+	return charset, collation, err
+}
+
+// WriteMySQLCharset detects & writes the database charset header, falling back to the
+// configured connection charset if detection fails.
+func writeMySQLCharset(db *sql.DB, w io.Writer, connCharset string) error {
+	charset, collation, err := detectCharset(db)
+	if err != nil {
+		app.Log(fmt.Sprintf("Unable to detect database charset, assuming %s: %s", connCharset, err.Error()))
+		charset, collation = connCharset, ""
+	}
+
+	app.Log(fmt.Sprintf("Database charset %s %s", charset, collation))
+
+	if strings.HasPrefix(charset, "utf8mb4") && !strings.HasPrefix(connCharset, "utf8mb4") {
+		fmt.Printf("Warning: database charset is %s but the connection charset is %s, 4-byte characters (eg: emoji) may be lost\n", charset, connCharset)
+	}
+
+	_, err = fmt.Fprintf(w, "%s\t%s %s\n", charsetPrefix, charset, collation)
+
+	return err
+}
+
+// MySQLCharsetSQL returns the statement to apply a `-- Database charset` header line
+// to the current database, or an empty string if the line is not valid.
+func mysqlCharsetSQL(line string) string {
+	parts := strings.Fields(strings.TrimPrefix(line, charsetPrefix))
+	if len(parts) == 0 || len(parts) > 2 {
+		return ""
+	}
+
+	for _, p := range parts {
+		if !charsetNameRegex.MatchString(p) {
+			return ""
+		}
+	}
+
+	sql := "ALTER DATABASE CHARACTER SET " + parts[0]
+	if len(parts) == 2 {
+		sql += " COLLATE " + parts[1]
+	}
+
+	return sql
+}
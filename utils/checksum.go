@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// ChecksumFile returns the path of the sha256 checksum file of a backup
+func checksumFile(file string) string {
+	return file + ".sha256"
+}
+
+// WriteChecksum writes the hash of a file to its checksum file, using the
+// same format as `sha256sum` so it can also be checked with `sha256sum -c`
+func writeChecksum(file string, h hash.Hash) error {
+	sum := hex.EncodeToString(h.Sum(nil))
+	out := fmt.Sprintf("%s  %s\n", sum, filepath.Base(file))
+
+	if isRemote(file) {
+		w, err := createRemote(checksumFile(file))
+		if err != nil {
+			return fmt.Errorf("Error writing checksum: %s", err.Error())
+		}
+		if _, err := io.WriteString(w, out); err != nil {
+			w.Abort()
+			return fmt.Errorf("Error writing checksum: %s", err.Error())
+		}
+		if err := w.Commit(); err != nil {
+			return fmt.Errorf("Error writing checksum: %s", err.Error())
+		}
+	} else if err := ioutil.WriteFile(checksumFile(file), []byte(out), 0644); err != nil { // #nosec
+		return fmt.Errorf("Error writing checksum: %s", err.Error())
+	}
+
+	app.Log(fmt.Sprintf("Wrote checksum '%s' (%s)", checksumFile(file), sum))
+
+	return nil
+}
+
+// ChecksumExists returns whether a backup has a sha256 checksum file
+func ChecksumExists(file string) bool {
+	return BackupExists(checksumFile(backupBase(file)))
+}
+
+// VerifyChecksum verifies a backup (or all volumes of a split backup) against
+// its sha256 checksum file
+func VerifyChecksum(file string) error {
+	file = backupBase(file)
+
+	cr, err := openBackup(checksumFile(file))
+	if err != nil {
+		return fmt.Errorf("Error reading checksum: %s", err.Error())
+	}
+
+	b, err := ioutil.ReadAll(cr)
+	cr.Close() // #nosec
+	if err != nil {
+		return fmt.Errorf("Error reading checksum: %s", err.Error())
+	}
+
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return errors.New("Error reading checksum: checksum file is empty")
+	}
+	expected := strings.ToLower(fields[0])
+
+	f, err := openBackup(file)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			fmt.Printf("Error closing file: %s\n", err)
+		}
+	}()
+
+	app.Log(fmt.Sprintf("Verifying checksum of '%s'", file))
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("Error reading '%s': %s", file, err.Error())
+	}
+
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != expected {
+		return fmt.Errorf("Checksum mismatch for '%s': expected %s, got %s", file, expected, actual)
+	}
+
+	return nil
+}
@@ -0,0 +1,281 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	// gzipMagic are the first bytes of any gzip stream
+	gzipMagic = []byte{0x1f, 0x8b}
+
+	// zstdMagic are the first bytes of any zstd frame
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	// bzip2Magic are the first bytes of any bzip2 stream
+	bzip2Magic = []byte("BZh")
+
+	// xzMagic are the first bytes of any xz stream
+	xzMagic = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// ValidateCodec returns an error if the compression codec is not supported
+func ValidateCodec(codec string) error {
+	switch codec {
+	case "gzip", "zstd", "bzip2", "xz", "none":
+		return nil
+	}
+
+	return fmt.Errorf("Unsupported compression codec '%s' (must be gzip, zstd, bzip2, xz or none)", codec)
+}
+
+// NewCompressWriter returns a compressing writer for the configured codec,
+// encrypting the compressed stream if app.Encrypt is set
+func newCompressWriter(w io.Writer) (io.WriteCloser, error) {
+	if err := ValidateCodec(app.Codec); err != nil {
+		return nil, err
+	}
+
+	if app.Encrypt {
+		ew, err := newEncryptWriter(w)
+		if err != nil {
+			return nil, err
+		}
+
+		cw, err := newCodecWriter(ew)
+		if err != nil {
+			return nil, err
+		}
+
+		return &stackedWriteCloser{cw, ew}, nil
+	}
+
+	return newCodecWriter(w)
+}
+
+// NewCodecWriter returns a compressing writer for the configured codec
+func newCodecWriter(w io.Writer) (io.WriteCloser, error) {
+	if app.Codec == "none" {
+		return nopWriteCloser{w}, nil
+	}
+
+	if app.Codec == "zstd" {
+		if err := ValidateCompressionLevel(app.CompressionLevel); err != nil {
+			return nil, err
+		}
+
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(app.CompressionLevel)))
+	}
+
+	// bzip2 & xz are compressed with their command line tools, see compresscmd.go
+	if app.Codec == "bzip2" || app.Codec == "xz" {
+		if err := ValidateCompressionLevel(app.CompressionLevel); err != nil {
+			return nil, err
+		}
+
+		args := []string{"--compress", "--stdout", fmt.Sprintf("-%d", app.CompressionLevel)}
+		if app.Codec == "xz" {
+			// compress with all CPU cores
+			args = append(args, "--threads=0")
+		}
+
+		return newCommandWriter(w, app.Codec, args...)
+	}
+
+	return newGzipWriter(w)
+}
+
+// NewDecompressReader returns a decompressing reader, detecting the codec (gzip, zstd,
+// bzip2, xz or uncompressed) & encryption from the magic bytes of the stream
+func newDecompressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	if isEncrypted(br) {
+		dr, err := newDecryptReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(dr)
+	}
+
+	magic, err := br.Peek(len(xzMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(magic, gzipMagic) {
+		return gzip.NewReader(br)
+	}
+
+	if bytes.HasPrefix(magic, zstdMagic) {
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+
+		return zr.IOReadCloser(), nil
+	}
+
+	// bzip2 is decompressed with the Go standard library, which has no bzip2 encoder
+	if bytes.HasPrefix(magic, bzip2Magic) {
+		return ioutil.NopCloser(bzip2.NewReader(br)), nil
+	}
+
+	if bytes.HasPrefix(magic, xzMagic) {
+		return newCommandReader(br, "xz", "--decompress", "--stdout")
+	}
+
+	// uncompressed SQL is text, so contains no null bytes
+	start, err := br.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.IndexByte(start, 0) < 0 {
+		return ioutil.NopCloser(br), nil
+	}
+
+	return nil, errors.New("Unknown compression format (expected gzip, zstd, bzip2, xz or uncompressed SQL)")
+}
+
+// NopWriteCloser writes uncompressed data, Close() is a no-op
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// StackedWriteCloser closes a writer followed by the writer beneath it
+type stackedWriteCloser struct {
+	io.WriteCloser
+	under io.Closer
+}
+
+func (s *stackedWriteCloser) Close() error {
+	if err := s.WriteCloser.Close(); err != nil {
+		return err
+	}
+
+	return s.under.Close()
+}
+
+// VerifyGzip reads a compressed (gzip, zstd, bzip2 or xz) file through to the end, returning
+// an error if the stream is corrupt or truncated. Uncompressed files are only read.
+func VerifyGzip(file string) error {
+	_, err := verifyCompressed(file, ioutil.Discard)
+
+	return err
+}
+
+// VerifyDump verifies a compressed database dump (see VerifyGzip), returning an error
+// if it is empty or contains no SQL statements creating or inserting anything, which
+// is almost certainly the wrong database or a user without the required privileges
+func verifyDump(file string) error {
+	statements := &statementDetector{}
+
+	n, err := verifyCompressed(file, statements)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return errors.New("The database dump is empty, check the database name & the user's privileges")
+	}
+
+	// data-only dumps of empty tables contain no statements
+	if !statements.detected() && len(app.DataOnlyTables) == 0 {
+		return errors.New("The database dump contains no CREATE, INSERT or COPY statements, check the database name & the user's privileges")
+	}
+
+	return nil
+}
+
+// VerifyCompressed reads a compressed file through to the end into w, returning the
+// uncompressed size
+func verifyCompressed(file string, w io.Writer) (int64, error) {
+	app.Log(fmt.Sprintf("Verifying '%s'", file))
+
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			fmt.Printf("Error closing file: %s\n", err)
+		}
+	}()
+
+	r, err := newDecompressReader(f)
+	if err != nil {
+		return 0, fmt.Errorf("Could not verify '%s': %s", file, err.Error())
+	}
+	defer r.Close()
+
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return n, fmt.Errorf("'%s' is corrupt: %s", file, err.Error())
+	}
+
+	return n, nil
+}
+
+// dumpStatements are the statements (at the start of a line) which create or insert
+// anything in MySQL, PostgreSQL & SQLite dumps
+var dumpStatements = []string{"CREATE ", "INSERT ", "REPLACE ", "COPY "}
+
+// StatementDetector detects whether any dumpStatements are written to it, only
+// checking the start of each line until one is found
+type statementDetector struct {
+	line  []byte
+	found bool
+}
+
+func (d *statementDetector) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if d.found {
+			break
+		}
+		if c == '\n' {
+			d.check()
+			d.line = d.line[:0]
+		} else if len(d.line) < 8 {
+			d.line = append(d.line, c)
+		}
+	}
+
+	return len(p), nil
+}
+
+// Check checks whether the start of the current line is a dumpStatement
+func (d *statementDetector) check() {
+	line := strings.ToUpper(string(d.line))
+	for _, stmt := range dumpStatements {
+		if strings.HasPrefix(line, stmt) {
+			d.found = true
+		}
+	}
+}
+
+// Detected returns whether a statement was found, including on a last line without
+// a trailing newline
+func (d *statementDetector) detected() bool {
+	if !d.found {
+		d.check()
+	}
+
+	return d.found
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	codec, level := app.Codec, app.CompressionLevel
+	defer func() { app.Codec, app.CompressionLevel = codec, level }()
+	app.CompressionLevel = 6
+
+	// long enough to span several pgzip blocks
+	sql := strings.Repeat("INSERT INTO `Member` VALUES (1,'a@b.com'),(2,'c@d.com');\n", 50000)
+
+	tests := []struct {
+		codec string
+		tool  string
+		magic []byte
+	}{
+		{"gzip", "", gzipMagic},
+		{"zstd", "", zstdMagic},
+		{"bzip2", "bzip2", bzip2Magic},
+		{"xz", "xz", xzMagic},
+		{"none", "", []byte("INSERT")},
+	}
+
+	for _, tt := range tests {
+		if tt.tool != "" {
+			if _, err := exec.LookPath(tt.tool); err != nil {
+				t.Logf("%s: skipped, %s is not installed", tt.codec, tt.tool)
+				continue
+			}
+		}
+
+		app.Codec = tt.codec
+
+		var compressed bytes.Buffer
+		w, err := newCompressWriter(&compressed)
+		if err != nil {
+			t.Errorf("%s: %s", tt.codec, err)
+			continue
+		}
+		if _, err := w.Write([]byte(sql)); err != nil {
+			t.Errorf("%s: %s", tt.codec, err)
+			continue
+		}
+		if err := w.Close(); err != nil {
+			t.Errorf("%s: %s", tt.codec, err)
+			continue
+		}
+
+		if !bytes.HasPrefix(compressed.Bytes(), tt.magic) {
+			t.Errorf("%s: output starts with %q, want %q", tt.codec, compressed.Bytes()[:6], tt.magic)
+		}
+
+		r, err := newDecompressReader(&compressed)
+		if err != nil {
+			t.Errorf("%s: %s", tt.codec, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close() // #nosec
+		if err != nil {
+			t.Errorf("%s: %s", tt.codec, err)
+			continue
+		}
+		if string(got) != sql {
+			t.Errorf("%s: decompressed %d bytes, want %d", tt.codec, len(got), len(sql))
+		}
+	}
+}
+
+func TestDecompressReaderDetection(t *testing.T) {
+	gzipped := func(s string) []byte {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		gw.Write([]byte(s)) // #nosec
+		gw.Close()          // #nosec
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+		err  bool
+	}{
+		{"gzip", gzipped("SELECT 1;\n"), "SELECT 1;\n", false},
+		{"concatenated gzip members", append(gzipped("SELECT 1;\n"), gzipped("SELECT 2;\n")...), "SELECT 1;\nSELECT 2;\n", false},
+		{"plain SQL", []byte("-- MySQL dump\nSELECT 1;\n"), "-- MySQL dump\nSELECT 1;\n", false},
+		{"short plain SQL", []byte("S"), "S", false},
+		{"empty", []byte{}, "", false},
+		{"binary", []byte{0x50, 0x4b, 0x03, 0x04, 0x00, 0x00}, "", true},
+	}
+
+	for _, tt := range tests {
+		r, err := newDecompressReader(bytes.NewReader(tt.in))
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: returned no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		got, err := ioutil.ReadAll(r)
+		r.Close() // #nosec
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: read %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
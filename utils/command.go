@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/go-sql-driver/mysql"
+)
+
+// The client tools & connections used are logged in verbose mode, with the database
+// password redacted, to help diagnose failing dumps & restores.
+
+var (
+	// loggedMu guards clientVersions & loggedDSNs
+	loggedMu sync.Mutex
+
+	// clientVersions are the versions of the client tools already logged, by path
+	clientVersions = map[string]string{}
+
+	// loggedDSNs are the MySQL connection strings already logged
+	loggedDSNs = map[string]bool{}
+)
+
+// LogCommand logs the path, version & arguments of a client tool before it is run
+func logCommand(bin string, args []string) {
+	if !app.Verbose {
+		return
+	}
+
+	loggedMu.Lock()
+	if _, ok := clientVersions[bin]; !ok {
+		version := "unknown version"
+		if out, err := exec.Command(bin, "--version").Output(); err == nil { // #nosec
+			if v := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0]); v != "" {
+				version = v
+			}
+		}
+		clientVersions[bin] = version
+		app.Log(fmt.Sprintf("Using %s (%s)", bin, version))
+	}
+	loggedMu.Unlock()
+
+	quoted := []string{bin}
+	for _, arg := range redactPasswordArgs(args) {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`;&|<>*?") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted = append(quoted, arg)
+	}
+
+	app.Log("Running: " + strings.Join(quoted, " "))
+}
+
+// LogMySQLConfig logs the MySQL connection string (once), with the password redacted
+func logMySQLConfig(config *mysql.Config) {
+	if !app.Verbose {
+		return
+	}
+
+	redacted := config.Clone()
+	if redacted.Passwd != "" {
+		redacted.Passwd = "****"
+	}
+	dsn := redacted.FormatDSN()
+
+	loggedMu.Lock()
+	defer loggedMu.Unlock()
+
+	if !loggedDSNs[dsn] {
+		loggedDSNs[dsn] = true
+		app.Log("MySQL connection: " + dsn)
+	}
+}
+
+// RedactPasswordArgs returns the arguments of a client tool with the values of any
+// password arguments replaced, ie: --password=<value>, --password <value> & -p<value>
+// (a numeric -p<value> is the port of the PostgreSQL tools). Passwords are otherwise
+// passed via the environment, so are never in the arguments.
+func redactPasswordArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		switch {
+		case i > 0 && args[i-1] == "--password":
+			redacted[i] = "****"
+		case strings.HasPrefix(arg, "--password="):
+			redacted[i] = "--password=****"
+		case len(arg) > 2 && strings.HasPrefix(arg, "-p") && !strings.HasPrefix(arg, "--") && strings.Trim(arg[2:], "0123456789") != "":
+			redacted[i] = "-p****"
+		default:
+			redacted[i] = arg
+		}
+	}
+
+	return redacted
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactPasswordArgs(t *testing.T) {
+	tests := []struct {
+		args string
+		want string
+	}{
+		{"--host=db --username=root --dbname=root", "--host=db --username=root --dbname=root"},
+		{"--password=secret --dbname=a", "--password=**** --dbname=a"},
+		{"--password secret --dbname a", "--password **** --dbname a"},
+		{"-psecret -h db", "-p**** -h db"},
+		{"-p 5432 -p5432", "-p 5432 -p5432"},
+		{"--port=5432 --pretty", "--port=5432 --pretty"},
+	}
+
+	for _, tt := range tests {
+		got := strings.Join(redactPasswordArgs(strings.Fields(tt.args)), " ")
+		if got != tt.want {
+			t.Errorf("redactPasswordArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
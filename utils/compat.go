@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MySQL dumps (both go-mysqldump and mysqldump) record the source server version in
+// their header, eg: `-- Server version	8.0.31`, which is compared to the target server
+// on restore.
+const serverVersionPrefix = "-- Server version"
+
+// MySQLCompatReplacer rewrites MySQL 8 collations unknown to MariaDB (and older MySQL
+// versions) to their closest equivalents when restoring with --compat
+var mysqlCompatReplacer = strings.NewReplacer(
+	"utf8mb4_0900_ai_ci", "utf8mb4_general_ci",
+	"utf8mb4_0900_as_ci", "utf8mb4_general_ci",
+	"utf8mb4_0900_as_cs", "utf8mb4_bin",
+	"utf8mb4_0900_bin", "utf8mb4_bin",
+)
+
+// MySQLIsDataStatement returns whether the first line of a statement inserts rows, whose
+// values must never be rewritten on restore (eg: text containing a collation name)
+func mysqlIsDataStatement(line string) bool {
+	upper := strings.ToUpper(strings.TrimSpace(line))
+
+	return strings.HasPrefix(upper, "INSERT ") || strings.HasPrefix(upper, "REPLACE ")
+}
+
+// MySQLDefinerRegex matches the DEFINER clause of a CREATE statement (routines, triggers,
+// events & views), eg: DEFINER=`user`@`host` or DEFINER=CURRENT_USER
+var mysqlDefinerRegex = regexp.MustCompile("(?i)\\bDEFINER\\s*=\\s*(CURRENT_USER(\\(\\))?|(`[^`]*`|'[^']*'|[\\w.$-]+)@(`[^`]*`|'[^']*'|[\\w.%-]+))\\s*")
+
+// MySQLStripDefiners removes any DEFINER clauses from a CREATE statement line, returning
+// the line & the number of clauses removed. Other lines (including data) are unchanged.
+// Without a DEFINER, routines are created as the restoring user, so a restore does
+// not fail if the original user does not exist on the target server.
+func mysqlStripDefiners(line string) (string, int) {
+	if !strings.HasPrefix(strings.ToUpper(line), "CREATE ") {
+		return line, 0
+	}
+
+	n := len(mysqlDefinerRegex.FindAllStringIndex(line, -1))
+	if n == 0 {
+		return line, 0
+	}
+
+	return mysqlDefinerRegex.ReplaceAllString(line, ""), n
+}
+
+// MySQLVariant returns "MariaDB" or "MySQL" for a server version string
+func mysqlVariant(version string) string {
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		return "MariaDB"
+	}
+
+	return "MySQL"
+}
+
+// MySQLMajorVersion returns the major version of a server version string, eg: 8 for 8.0.31
+func mysqlMajorVersion(version string) int {
+	v, _ := strconv.Atoi(strings.SplitN(strings.TrimSpace(version), ".", 2)[0])
+
+	return v
+}
+
+// MySQLCompatibilityWarning returns a warning if a dump from the source server version is
+// likely to fail or behave differently when restored to the target server version,
+// or an empty string if they are compatible.
+func mysqlCompatibilityWarning(source, target string) string {
+	source = strings.TrimSpace(source)
+	target = strings.TrimSpace(target)
+	if source == "" || target == "" {
+		return ""
+	}
+
+	sourceVariant, targetVariant := mysqlVariant(source), mysqlVariant(target)
+
+	if sourceVariant != targetVariant {
+		msg := fmt.Sprintf(
+			"Warning: backup was made from %s %s but is being restored to %s %s",
+			sourceVariant, source, targetVariant, target,
+		)
+		if sourceVariant == "MySQL" && mysqlMajorVersion(source) >= 8 {
+			msg += " - MySQL 8 collations such as utf8mb4_0900_ai_ci are not supported by MariaDB"
+		}
+
+		return msg
+	}
+
+	if mysqlMajorVersion(source) != mysqlMajorVersion(target) {
+		return fmt.Sprintf(
+			"Warning: backup was made from %s %s but is being restored to %s %s",
+			sourceVariant, source, targetVariant, target,
+		)
+	}
+
+	return ""
+}
@@ -0,0 +1,121 @@
+package utils
+
+import "testing"
+
+func TestMySQLCompatReplacer(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{
+			"  `Title` varchar(255) COLLATE utf8mb4_0900_ai_ci DEFAULT NULL,",
+			"  `Title` varchar(255) COLLATE utf8mb4_general_ci DEFAULT NULL,",
+		},
+		{
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_as_cs;",
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;",
+		},
+		{
+			"  `Code` varchar(10) COLLATE utf8mb4_0900_bin, `Name` varchar(10) COLLATE utf8mb4_0900_as_ci,",
+			"  `Code` varchar(10) COLLATE utf8mb4_bin, `Name` varchar(10) COLLATE utf8mb4_general_ci,",
+		},
+		{
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;",
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := mysqlCompatReplacer.Replace(tt.line); got != tt.want {
+			t.Errorf("mysqlCompatReplacer.Replace(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestMySQLCompatibilityWarning(t *testing.T) {
+	tests := []struct {
+		source string
+		target string
+		warn   bool
+	}{
+		{"8.0.31", "8.0.35", false},
+		{"10.6.12-MariaDB", "10.11.2-MariaDB-1:10.11.2+maria~ubu2204", false},
+		{"5.7.40", "8.0.31", true},
+		{"8.0.31", "10.6.12-MariaDB", true},
+		{"", "8.0.31", false},
+	}
+
+	for _, tt := range tests {
+		if got := mysqlCompatibilityWarning(tt.source, tt.target); (got != "") != tt.warn {
+			t.Errorf("mysqlCompatibilityWarning(%q, %q) = %q, want warning %v", tt.source, tt.target, got, tt.warn)
+		}
+	}
+}
+
+func TestMySQLStripDefiners(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+		n    int
+	}{
+		{
+			"CREATE DEFINER=`root`@`localhost` PROCEDURE `p`()",
+			"CREATE PROCEDURE `p`()", 1,
+		},
+		{
+			"CREATE DEFINER='admin'@'%' FUNCTION `f`() RETURNS int",
+			"CREATE FUNCTION `f`() RETURNS int", 1,
+		},
+		{
+			"CREATE ALGORITHM=UNDEFINED DEFINER=`a-b`@`10.0.%` SQL SECURITY DEFINER VIEW `v` AS select 1",
+			"CREATE ALGORITHM=UNDEFINED SQL SECURITY DEFINER VIEW `v` AS select 1", 1,
+		},
+		{
+			"CREATE definer = CURRENT_USER TRIGGER `t` BEFORE INSERT ON `Member`",
+			"CREATE TRIGGER `t` BEFORE INSERT ON `Member`", 1,
+		},
+		{
+			"CREATE DEFINER=CURRENT_USER() EVENT `e` ON SCHEDULE EVERY 1 DAY",
+			"CREATE EVENT `e` ON SCHEDULE EVERY 1 DAY", 1,
+		},
+		{
+			"CREATE DEFINER=root@localhost PROCEDURE `p`()",
+			"CREATE PROCEDURE `p`()", 1,
+		},
+		{
+			"CREATE TABLE `Member` (",
+			"CREATE TABLE `Member` (", 0,
+		},
+		{
+			"INSERT INTO `Member` VALUES (1,'DEFINER=`root`@`localhost`');",
+			"INSERT INTO `Member` VALUES (1,'DEFINER=`root`@`localhost`');", 0,
+		},
+	}
+
+	for _, tt := range tests {
+		got, n := mysqlStripDefiners(tt.line)
+		if got != tt.want || n != tt.n {
+			t.Errorf("mysqlStripDefiners(%q) = %q, %d, want %q, %d", tt.line, got, n, tt.want, tt.n)
+		}
+	}
+}
+
+func TestMySQLIsDataStatement(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"INSERT INTO `Member` VALUES (1,'utf8mb4_0900_ai_ci');", true},
+		{"  insert ignore into `Member` VALUES (1);", true},
+		{"REPLACE INTO `Member` VALUES (1);", true},
+		{"CREATE TABLE `Member` (", false},
+		{"  `Name` varchar(50) COLLATE utf8mb4_0900_ai_ci,", false},
+		{"INSERTED", false},
+	}
+
+	for _, tt := range tests {
+		if got := mysqlIsDataStatement(tt.line); got != tt.want {
+			t.Errorf("mysqlIsDataStatement(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
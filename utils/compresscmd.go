@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// The bzip2 & xz codecs compress with the bzip2 & xz command line tools, which are
+// standard on most servers, rather than adding a Go encoder dependency for each: the
+// xz tool compresses on all CPU cores, which the Go xz encoders do not, and the Go
+// bzip2 encoders are much slower than bzip2 itself. Their output is streamed through
+// the tool, so like the other codecs the dump is never written to disk uncompressed.
+
+// CommandWriter compresses the data written to it with a command line tool
+type commandWriter struct {
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+}
+
+// NewCommandWriter starts a compression tool writing its output to w
+func newCommandWriter(w io.Writer, name string, args ...string) (io.WriteCloser, error) {
+	bin, err := clientBinary(name)
+	if err != nil {
+		return nil, err
+	}
+
+	logCommand(bin, args)
+
+	cw := &commandWriter{name: name}
+	cw.cmd = exec.CommandContext(app.Context(), bin, args...) // #nosec
+	cw.cmd.Stdout = w
+	cw.cmd.Stderr = &cw.stderr
+
+	cw.stdin, err = cw.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cw.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err.Error())
+	}
+
+	return cw, nil
+}
+
+func (cw *commandWriter) Write(p []byte) (int, error) {
+	n, err := cw.stdin.Write(p)
+	if err != nil {
+		return n, fmt.Errorf("%s: %s", cw.name, err.Error())
+	}
+
+	return n, nil
+}
+
+// Close waits for the tool to write the remaining compressed data
+func (cw *commandWriter) Close() error {
+	if err := cw.stdin.Close(); err != nil {
+		return err
+	}
+
+	return commandError(cw.name, cw.cmd.Wait(), cw.stderr.String())
+}
+
+// CommandReader decompresses the data read from r with a command line tool
+type commandReader struct {
+	name   string
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	once   sync.Once
+	err    error
+}
+
+// NewCommandReader starts a decompression tool reading its input from r
+func newCommandReader(r io.Reader, name string, args ...string) (io.ReadCloser, error) {
+	bin, err := clientBinary(name)
+	if err != nil {
+		return nil, err
+	}
+
+	logCommand(bin, args)
+
+	cr := &commandReader{name: name}
+	cr.cmd = exec.CommandContext(app.Context(), bin, args...) // #nosec
+	cr.cmd.Stdin = r
+	cr.cmd.Stderr = &cr.stderr
+
+	cr.stdout, err = cr.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cr.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err.Error())
+	}
+
+	return cr, nil
+}
+
+// Read returns the decompressed data, and any error of the tool once all is read,
+// so a corrupt or truncated stream is not mistaken for the end of the data
+func (cr *commandReader) Read(p []byte) (int, error) {
+	n, err := cr.stdout.Read(p)
+	if err == io.EOF {
+		if werr := cr.wait(); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
+
+// Close stops the tool if the data was not read through to the end
+func (cr *commandReader) Close() error {
+	cr.once.Do(func() {
+		_ = cr.cmd.Process.Kill()
+		_ = cr.cmd.Wait()
+	})
+
+	return nil
+}
+
+// Wait waits for the tool to exit, returning its error
+func (cr *commandReader) wait() error {
+	cr.once.Do(func() {
+		cr.err = commandError(cr.name, cr.cmd.Wait(), cr.stderr.String())
+	})
+
+	return cr.err
+}
+
+// CommandError returns the error of a command line tool, including its stderr
+func commandError(name string, err error, stderr string) error {
+	if err == nil {
+		return nil
+	}
+
+	if msg := strings.TrimSpace(stderr); msg != "" {
+		return fmt.Errorf("%s: %s", name, msg)
+	}
+
+	return fmt.Errorf("%s: %s", name, err.Error())
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+	"golang.org/x/term"
+)
+
+// ConfirmDropDatabase asks for the database name to be typed before it is dropped,
+// returning an error if it does not match. Confirmation is skipped with yes, or
+// when stdin is not a terminal (eg: cron jobs or scripts).
+func ConfirmDropDatabase(name string, yes bool) error {
+	if yes || !term.IsTerminal(int(os.Stdin.Fd())) { // #nosec
+		reason := "--yes"
+		if !yes {
+			reason = "not a terminal"
+		}
+		app.LogEvent(
+			"drop_confirmed", fmt.Sprintf("Dropping database '%s' without confirmation (%s)", name, reason),
+			"database", name, "confirmed", reason,
+		)
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "This will drop the %s database '%s' and all of its data.\nType the database name to continue: ", app.DB.Type, name)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return fmt.Errorf("Error reading confirmation: %s", err.Error())
+	}
+
+	if strings.TrimSpace(answer) != name {
+		app.LogToFile("INFO", fmt.Sprintf("Dropping database '%s' cancelled", name))
+		return errors.New("Database name does not match, cancelled (use --yes to skip the confirmation)")
+	}
+
+	app.LogEvent("drop_confirmed", fmt.Sprintf("Dropping database '%s' (confirmed)", name), "database", name, "confirmed", "prompt")
+
+	return nil
+}
@@ -0,0 +1,300 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/axllent/ssbak/app"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// Encrypted database dumps are written as a header (magic bytes, a format version
+// & a random scrypt salt) followed by AES-256-GCM sealed chunks of up to
+// encryptChunkSize bytes. Each chunk is prefixed with its length & a flag marking
+// the final chunk, and uses its sequence number as the nonce, so truncated,
+// reordered or modified chunks fail to decrypt.
+const (
+	encryptVersion   = 1
+	encryptSaltSize  = 16
+	encryptChunkSize = 64 * 1024
+
+	// PassphraseEnv is the environment variable the encryption passphrase is read from
+	PassphraseEnv = "SSBAK_PASSPHRASE"
+)
+
+// encryptMagic are the first bytes of an encrypted stream
+var encryptMagic = []byte("SSBAKENC")
+
+// ReadPassphrase sets app.Passphrase from the SSBAK_PASSPHRASE environment variable,
+// else prompts for it on the terminal (twice if confirm is set)
+func ReadPassphrase(confirm bool) error {
+	if app.Passphrase != "" {
+		return nil
+	}
+
+	if v := os.Getenv(PassphraseEnv); v != "" {
+		app.Passphrase = v
+		return nil
+	}
+
+	fd := int(os.Stdin.Fd()) // #nosec
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("No passphrase set, please set %s", PassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return fmt.Errorf("Error reading passphrase: %s", err.Error())
+	}
+
+	if len(pass) == 0 {
+		return errors.New("Passphrase cannot be empty")
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return fmt.Errorf("Error reading passphrase: %s", err.Error())
+		}
+		if !bytes.Equal(pass, again) {
+			return errors.New("Passphrases do not match")
+		}
+	}
+
+	app.Passphrase = string(pass)
+
+	return nil
+}
+
+// EncryptionKey derives the AES-256 key from the passphrase & salt
+func encryptionKey(salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(app.Passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// ChunkNonce returns the GCM nonce for a chunk sequence number
+func chunkNonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], seq)
+
+	return nonce
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	buf    []byte
+	seq    uint64
+	closed bool
+}
+
+// NewEncryptWriter returns a writer encrypting with the app.Passphrase. Close()
+// must be called to write the final chunk, but does not close the underlying writer.
+func newEncryptWriter(w io.Writer) (io.WriteCloser, error) {
+	if app.Passphrase == "" {
+		return nil, errors.New("No encryption passphrase set")
+	}
+
+	salt := make([]byte, encryptSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := encryptionKey(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append(append(append([]byte{}, encryptMagic...), encryptVersion), salt...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{w: w, aead: aead, buf: make([]byte, 0, encryptChunkSize)}, nil
+}
+
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		c := copy(ew.buf[len(ew.buf):cap(ew.buf)], p)
+		ew.buf = ew.buf[:len(ew.buf)+c]
+		p = p[c:]
+		n += c
+
+		if len(ew.buf) == cap(ew.buf) && len(p) > 0 {
+			if err := ew.writeChunk(false); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Close writes the remaining buffer as the final chunk
+func (ew *encryptWriter) Close() error {
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+
+	return ew.writeChunk(true)
+}
+
+func (ew *encryptWriter) writeChunk(final bool) error {
+	flag := byte(0)
+	if final {
+		flag = 1
+	}
+
+	sealed := ew.aead.Seal(nil, chunkNonce(ew.aead, ew.seq), ew.buf, []byte{flag})
+	ew.seq++
+	ew.buf = ew.buf[:0]
+
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header, uint32(len(sealed))) // #nosec
+	header[4] = flag
+
+	if _, err := ew.w.Write(header); err != nil {
+		return err
+	}
+	_, err := ew.w.Write(sealed)
+
+	return err
+}
+
+type decryptReader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	buf   []byte
+	seq   uint64
+	final bool
+}
+
+// NewDecryptReader returns a reader decrypting a stream written by newEncryptWriter,
+// reading the passphrase if it has not already been set
+func newDecryptReader(r io.Reader) (io.Reader, error) {
+	header := make([]byte, len(encryptMagic)+1+encryptSaltSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("Error reading encryption header: %s", err.Error())
+	}
+
+	if version := header[len(encryptMagic)]; version != encryptVersion {
+		return nil, fmt.Errorf("Unsupported encryption version %d", version)
+	}
+
+	if err := ReadPassphrase(false); err != nil {
+		return nil, err
+	}
+
+	aead, err := encryptionKey(header[len(encryptMagic)+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{r: r, aead: aead}, nil
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.buf) == 0 {
+		if dr.final {
+			return 0, io.EOF
+		}
+		if err := dr.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, dr.buf)
+	dr.buf = dr.buf[n:]
+
+	return n, nil
+}
+
+func (dr *decryptReader) readChunk() error {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(dr.r, header); err != nil {
+		return fmt.Errorf("Encrypted stream is truncated: %s", err.Error())
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	if size > encryptChunkSize+uint32(dr.aead.Overhead()) {
+		return errors.New("Encrypted stream is corrupt")
+	}
+
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(dr.r, sealed); err != nil {
+		return fmt.Errorf("Encrypted stream is truncated: %s", err.Error())
+	}
+
+	plain, err := dr.aead.Open(nil, chunkNonce(dr.aead, dr.seq), sealed, header[4:])
+	if err != nil {
+		return errors.New("Unable to decrypt, wrong passphrase or corrupt backup")
+	}
+
+	dr.seq++
+	dr.buf = plain
+	dr.final = header[4] == 1
+
+	return nil
+}
+
+// IsEncrypted returns whether a buffered stream starts with the encryption magic bytes
+func isEncrypted(br *bufio.Reader) bool {
+	magic, _ := br.Peek(len(encryptMagic))
+
+	return bytes.HasPrefix(magic, encryptMagic)
+}
+
+// CheckPassphrase returns an error if a database backup is encrypted and cannot be
+// decrypted with the passphrase (which is read if not already set), so a wrong
+// passphrase is detected before the database is dropped or modified
+func CheckPassphrase(file string) error {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			fmt.Printf("Error closing file: %s\n", err)
+		}
+	}()
+
+	br := bufio.NewReader(f)
+	if !isEncrypted(br) {
+		return nil
+	}
+
+	r, err := newDecryptReader(br)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Read(make([]byte, 1))
+
+	return err
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// SchemaOnlyMarker is written at the start of schema-only database dumps so they
+// cannot be mistaken for full backups when restored
+const SchemaOnlyMarker = "-- SSBak schema-only dump (no data)"
+
+// Database is implemented by each supported database type. This keeps the calling
+// commands engine-agnostic without having to wrap them in a whole bunch of if/else
+// statements.
+type Database interface {
+	// DumpToGz streams a database dump into a compressed file
+	DumpToGz(gzipFile string) (DumpResult, error)
+
+	// CreateDB creates the database (if not exists), optionally dropping it first
+	CreateDB(dropDatabase bool) error
+
+	// LoadFromGz loads a compressed database dump into the database
+	LoadFromGz(gzipSQLFile string) (LoadResult, error)
+
+	// TestConnection verifies the server can be connected to and the database exists
+	TestConnection() error
+
+	// ExecSQL runs one or more SQL statements in the database
+	ExecSQL(statements string) error
+}
+
+// NewDatabase returns the Database implementation for the db.Type, connecting with
+// the db settings
+func NewDatabase(db app.DBStruct) (Database, error) {
+	switch db.Type {
+	case "MySQL":
+		return MySQLDatabase{DB: db}, nil
+	case "PostgreSQL":
+		return PostgresDatabase{DB: db}, nil
+	case "SQLite":
+		return SQLiteDatabase{DB: db}, nil
+	}
+
+	return nil, fmt.Errorf("Database %s not supported", db.Type)
+}
+
+// MySQLDatabase implements Database for MySQL & MariaDB
+type MySQLDatabase struct {
+	// DB is the connection settings of the database
+	DB app.DBStruct
+}
+
+// DumpToGz streams a database dump into a compressed file
+func (d MySQLDatabase) DumpToGz(gzipFile string) (DumpResult, error) {
+	return MySQLDumpToGz(d.DB, gzipFile)
+}
+
+// CreateDB creates the database (if not exists), optionally dropping it first
+func (d MySQLDatabase) CreateDB(dropDatabase bool) error {
+	return MySQLCreateDB(d.DB, dropDatabase)
+}
+
+// LoadFromGz loads a compressed database dump into the database
+func (d MySQLDatabase) LoadFromGz(gzipSQLFile string) (LoadResult, error) {
+	return MySQLLoadFromGz(d.DB, gzipSQLFile)
+}
+
+// TestConnection verifies the server can be connected to and the database exists
+func (d MySQLDatabase) TestConnection() error {
+	return MySQLTestConnection(d.DB)
+}
+
+// ExecSQL runs one or more SQL statements in the database
+func (d MySQLDatabase) ExecSQL(statements string) error {
+	return MySQLExecSQL(d.DB, statements)
+}
+
+// PostgresDatabase implements Database for PostgreSQL
+type PostgresDatabase struct {
+	// DB is the connection settings of the database
+	DB app.DBStruct
+}
+
+// DumpToGz streams a database dump into a compressed file
+func (d PostgresDatabase) DumpToGz(gzipFile string) (DumpResult, error) {
+	return PostgresDumpToGz(d.DB, gzipFile)
+}
+
+// CreateDB creates the database (if not exists), optionally dropping it first
+func (d PostgresDatabase) CreateDB(dropDatabase bool) error {
+	return PostgresCreateDB(d.DB, dropDatabase)
+}
+
+// LoadFromGz loads a compressed database dump into the database
+func (d PostgresDatabase) LoadFromGz(gzipSQLFile string) (LoadResult, error) {
+	return PostgresLoadFromGz(d.DB, gzipSQLFile)
+}
+
+// TestConnection verifies the server can be connected to and the database exists
+func (d PostgresDatabase) TestConnection() error {
+	return PostgresTestConnection(d.DB)
+}
+
+// ExecSQL runs one or more SQL statements in the database
+func (d PostgresDatabase) ExecSQL(statements string) error {
+	return PostgresExecSQL(d.DB, statements)
+}
+
+// SQLiteDatabase implements Database for SQLite
+type SQLiteDatabase struct {
+	// DB is the connection settings of the database
+	DB app.DBStruct
+}
+
+// DumpToGz streams a database dump into a compressed file
+func (d SQLiteDatabase) DumpToGz(gzipFile string) (DumpResult, error) {
+	return SQLiteDumpToGz(d.DB, gzipFile)
+}
+
+// CreateDB creates the database (if not exists), optionally dropping it first
+func (d SQLiteDatabase) CreateDB(dropDatabase bool) error {
+	return SQLiteCreateDB(d.DB, dropDatabase)
+}
+
+// LoadFromGz loads a compressed database dump into the database
+func (d SQLiteDatabase) LoadFromGz(gzipSQLFile string) (LoadResult, error) {
+	return SQLiteLoadFromGz(d.DB, gzipSQLFile)
+}
+
+// TestConnection verifies the server can be connected to and the database exists
+func (d SQLiteDatabase) TestConnection() error {
+	return SQLiteTestConnection(d.DB)
+}
+
+// ExecSQL runs one or more SQL statements in the database
+func (d SQLiteDatabase) ExecSQL(statements string) error {
+	return SQLiteExecSQL(d.DB, statements)
+}
+
+// DumpCompressionRatio is the assumed compression ratio of database dumps when
+// estimating the space required
+const dumpCompressionRatio = 5
+
+// CheckDumpSpace checks the free space of the dump directory before dumping, given the
+// (uncompressed) size of the data. It returns an error if less than app.MinFree would
+// remain, and warns if the estimated dump size exceeds the free space.
+func checkDumpSpace(dir string, dataSize int64) error {
+	free, err := FreeSpace(dir)
+	if err != nil {
+		app.Log(fmt.Sprintf("Unable to check the free space of '%s': %s", dir, err.Error()))
+		return nil
+	}
+
+	estimate := dataSize / dumpCompressionRatio
+
+	app.Log(fmt.Sprintf("Estimated database dump size +-%s, %s available", ByteToHr(estimate), ByteToHr(free)))
+
+	if app.MinFree > 0 && free-estimate < app.MinFree {
+		return classify(ErrDiskFull, fmt.Errorf(
+			"'%s' would have less than %s free after the database dump (+-%s estimated, %s available)",
+			dir, ByteToHr(app.MinFree), ByteToHr(estimate), ByteToHr(free),
+		))
+	}
+
+	if estimate > free {
+		fmt.Printf(
+			"Warning: '%s' may not have enough space for the database dump (+-%s estimated, %s available)\n",
+			dir, ByteToHr(estimate), ByteToHr(free),
+		)
+	}
+
+	return nil
+}
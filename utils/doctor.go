@@ -0,0 +1,287 @@
+package utils
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// The doctor checks everything a backup needs (the site configuration, client tools,
+// database connection, writable directories & free space) without creating a backup,
+// eg: to verify a new deployment before relying on scheduled backups.
+
+// DoctorCheck is the outcome of a single doctor check
+type DoctorCheck struct {
+	// Name of the check, eg: "Database connection"
+	Name string
+
+	// Detail of a passed check, eg: the path of a client tool
+	Detail string
+
+	// Err is the reason the check failed, or nil if it passed
+	Err error
+}
+
+// Passed returns whether the check passed
+func (c DoctorCheck) Passed() bool {
+	return c.Err == nil
+}
+
+// Skipped returns whether the check was skipped, as a check it depends on failed
+func (c DoctorCheck) Skipped() bool {
+	return c.Err == errDoctorSkipped
+}
+
+// errDoctorSkipped is the error of checks which cannot run as an earlier check failed
+var errDoctorSkipped = errors.New("Skipped")
+
+// Doctor runs the checks for the site in webroot, saving backups to outDir, returning
+// the outcome of each check. A failed check does not stop the remaining checks,
+// except those which depend on it, which are skipped.
+func Doctor(webroot, outDir string) []DoctorCheck {
+	checks := []DoctorCheck{}
+	run := func(name string, skip bool, check func() (string, error)) bool {
+		if skip {
+			checks = append(checks, DoctorCheck{Name: name, Err: errDoctorSkipped})
+			return false
+		}
+		detail, err := check()
+		checks = append(checks, DoctorCheck{name, detail, err})
+		return err == nil
+	}
+
+	configured := run("Site configuration", false, func() (string, error) {
+		if err := app.BootstrapEnv(webroot); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s database '%s' in '%s'", app.DB.Type, app.DB.Name, app.ProjectRoot), nil
+	})
+
+	run("Client tools", !configured, doctorClientTools)
+
+	connected := run("Database connection", !configured, func() (string, error) {
+		db, err := NewDatabase(app.DB)
+		if err != nil {
+			return "", err
+		}
+		if err := db.TestConnection(); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Connected to %s database '%s'", app.DB.Type, app.DB.Name), nil
+	})
+
+	run("Server compatibility", !connected, doctorServerVersion)
+
+	tmpDir := app.GetTempDir()
+	tmpWritable := run("Temporary directory", false, func() (string, error) {
+		return tmpDir, doctorWritable(tmpDir)
+	})
+	outWritable := run("Output directory", false, func() (string, error) {
+		return outDir, doctorWritable(outDir)
+	})
+
+	run("Disk space", !configured || !tmpWritable || !outWritable, func() (string, error) {
+		return doctorDiskSpace(tmpDir, outDir, connected)
+	})
+
+	return checks
+}
+
+// DoctorClientTools checks the client (and compression) tools needed by the database
+// type & codec can be found
+func doctorClientTools() (string, error) {
+	tools := []string{}
+	switch app.DB.Type {
+	case "PostgreSQL":
+		tools = append(tools, "pg_dump", "psql", "createdb", "dropdb")
+	case "SQLite":
+		tools = append(tools, "sqlite3")
+	}
+	if app.Codec == "bzip2" || app.Codec == "xz" {
+		tools = append(tools, app.Codec)
+	}
+
+	if len(tools) == 0 {
+		return "None required, MySQL is dumped & restored without the MySQL client tools", nil
+	}
+
+	found := []string{}
+	for _, name := range tools {
+		bin, err := clientBinary(name)
+		if err != nil {
+			return "", err
+		}
+		found = append(found, bin)
+	}
+
+	return strings.Join(found, ", "), nil
+}
+
+// DoctorServerVersion returns the database server version, checking pg_dump is not
+// older than a PostgreSQL server, which pg_dump refuses to dump
+func doctorServerVersion() (string, error) {
+	switch app.DB.Type {
+	case "MySQL":
+		version, err := mysqlServerVersion(app.DB)
+		if err != nil {
+			return "", classifyError(err)
+		}
+		return fmt.Sprintf("%s %s", mysqlVariant(version), version), nil
+
+	case "PostgreSQL":
+		var out bytes.Buffer
+		if err := runPg(app.DB, "psql", nil, &out, "--dbname="+app.DB.Name, "--tuples-only", "--no-align", "--command=SHOW server_version_num"); err != nil {
+			return "", err
+		}
+		serverNum, _ := strconv.Atoi(strings.TrimSpace(out.String()))
+		server := serverNum / 10000
+
+		dumpVersion, err := doctorCommandVersion("pg_dump")
+		if err != nil {
+			return "", err
+		}
+		// eg: pg_dump (PostgreSQL) 16.2
+		fields := strings.Fields(dumpVersion)
+		client := mysqlMajorVersion(fields[len(fields)-1])
+
+		if server == 0 || client == 0 {
+			return fmt.Sprintf("Unable to compare %s to server version %d", dumpVersion, serverNum), nil
+		}
+		if client < server {
+			return "", fmt.Errorf(
+				"pg_dump %d is older than the PostgreSQL %d server, and cannot dump it. Install pg_dump %d or newer, or set SSBAK_PG_DUMP to its path",
+				client, server, server,
+			)
+		}
+		return fmt.Sprintf("PostgreSQL %d server, %s", server, dumpVersion), nil
+
+	case "SQLite":
+		version, err := doctorCommandVersion("sqlite3", "-version")
+		if err != nil {
+			return "", err
+		}
+		return "sqlite3 " + strings.Fields(version)[0], nil
+	}
+
+	return "", fmt.Errorf("Database %s not supported", app.DB.Type)
+}
+
+// DoctorCommandVersion returns the first line of a client tool's version output
+func doctorCommandVersion(name string, args ...string) (string, error) {
+	bin, err := clientBinary(name)
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		args = []string{"--version"}
+	}
+
+	out, err := exec.CommandContext(app.Context(), bin, args...).Output() // #nosec
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", name, err.Error())
+	}
+
+	version := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	if version == "" {
+		return "", fmt.Errorf("%s: no version returned", name)
+	}
+
+	return version, nil
+}
+
+// DoctorWritable checks a file can be created in a directory
+func doctorWritable(dir string) error {
+	if !IsDir(dir) {
+		return fmt.Errorf("'%s' is not a directory", dir)
+	}
+
+	f, err := ioutil.TempFile(dir, ".ssbak-doctor-")
+	if err != nil {
+		return classifyError(fmt.Errorf("'%s' is not writable: %s", dir, err.Error()))
+	}
+
+	f.Close()           // #nosec
+	os.Remove(f.Name()) // #nosec
+
+	return nil
+}
+
+// DoctorDiskSpace checks the temporary & output directories have enough space for a
+// backup, estimated from the database & assets sizes
+func doctorDiskSpace(tmpDir, outDir string, connected bool) (string, error) {
+	var dbSize int64
+	if connected {
+		size, err := doctorDatabaseSize()
+		if err != nil {
+			app.Log(fmt.Sprintf("Unable to read the database size: %s", err.Error()))
+		}
+		dbSize = size / dumpCompressionRatio
+	}
+
+	var assetsSize int64
+	for _, dir := range []string{filepath.Join(app.ProjectRoot, "assets"), filepath.Join(app.ProjectRoot, "public", "assets")} {
+		if IsDir(dir) {
+			assetsSize, _ = CalcSize(app.RealPath(dir))
+			break
+		}
+	}
+
+	// the database dump & assets archive are written to the temporary directory before
+	// being combined into the sspak file in the output directory
+	required := dbSize + assetsSize
+	for _, dir := range []string{tmpDir, outDir} {
+		if err := HasEnoughSpace(dir, required); err != nil {
+			return "", err
+		}
+	}
+
+	detail := fmt.Sprintf("+-%s required (database +-%s, assets %s)", ByteToHr(required), ByteToHr(dbSize), ByteToHr(assetsSize))
+	if free, err := FreeSpace(outDir); err == nil {
+		detail += fmt.Sprintf(", %s available", ByteToHr(free))
+	}
+
+	return detail, nil
+}
+
+// DoctorDatabaseSize returns the size of the database on the server (or disk)
+func doctorDatabaseSize() (int64, error) {
+	switch app.DB.Type {
+	case "MySQL":
+		config, err := mysqlConfig(app.DB)
+		if err != nil {
+			return 0, err
+		}
+		db, err := sql.Open(mysqlDriver, config.FormatDSN())
+		if err != nil {
+			return 0, err
+		}
+		defer db.Close()
+
+		var size int64
+		for _, s := range mysqlTableSizes(db) {
+			size += s
+		}
+		return size, nil
+
+	case "PostgreSQL":
+		var out bytes.Buffer
+		if err := runPg(app.DB, "psql", nil, &out, "--dbname="+app.DB.Name, "--tuples-only", "--no-align", "--command=SELECT pg_database_size(current_database())"); err != nil {
+			return 0, err
+		}
+		return strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64)
+
+	case "SQLite":
+		return CalcSize(sqliteFile(app.DB))
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// Errors returned by the database functions are classified into the following
+// categories, which can be tested with errors.Is(), eg: errors.Is(err, ErrAuth).
+// The error messages are unchanged.
+var (
+	// ErrAuth is an authentication failure, eg: a wrong user or password
+	ErrAuth = errors.New("authentication failed")
+
+	// ErrPermission is a user lacking the privileges for an operation
+	ErrPermission = errors.New("permission denied")
+
+	// ErrConnection is a failure to connect to, or a lost connection with, the server
+	ErrConnection = errors.New("connection error")
+
+	// ErrDiskFull is a lack of disk space
+	ErrDiskFull = errors.New("not enough disk space")
+
+	// ErrBinaryNotFound is a required executable (eg: pg_dump) which cannot be found
+	ErrBinaryNotFound = errors.New("binary not found")
+)
+
+// ClassifiedError is an error marked with its category
+type classifiedError struct {
+	kind error
+	err  error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// Classify marks an error with a category, leaving the message unchanged
+func classify(kind, err error) error {
+	return &classifiedError{kind, err}
+}
+
+// ErrorCategories map (lowercase) error messages to their categories, which are
+// checked in order. MySQL server errors are matched by their number, eg: Error 1045.
+var errorCategories = []struct {
+	kind     error
+	messages []string
+}{
+	{ErrAuth, []string{"error 1045", "error 1698", "authentication failed", "password authentication"}},
+	{ErrPermission, []string{"error 1044", "error 1142", "error 1143", "error 1227", "error 1370", "permission denied"}},
+	{ErrDiskFull, []string{"no space left on device", "disk full", "error 1021", "error 1114"}},
+	{ErrConnection, append([]string{"cannot connect to", "no such host", "error 2002", "error 2003", "error 2006", "error 2013"}, transientErrors...)},
+	{ErrBinaryNotFound, []string{"not found in $path", "executable file not found"}},
+}
+
+// ClassifyError marks an error with its category (if any), detected from the
+// underlying error or its message. Errors which are already classified are unchanged.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	for _, kind := range []error{ErrAuth, ErrPermission, ErrConnection, ErrDiskFull, ErrBinaryNotFound} {
+		if errors.Is(err, kind) {
+			return err
+		}
+	}
+
+	if errors.Is(err, syscall.ENOSPC) {
+		return classify(ErrDiskFull, err)
+	}
+
+	if errors.Is(err, exec.ErrNotFound) {
+		return classify(ErrBinaryNotFound, err)
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, c := range errorCategories {
+		for _, m := range c.messages {
+			if strings.Contains(msg, m) {
+				return classify(c.kind, err)
+			}
+		}
+	}
+
+	return err
+}
+
+// ExitCodes are the process exit codes of each error category, so scripts can react
+// to the cause of a failure (eg: retry on a connection error). Any other error exits
+// with 1, and an interrupted command with 130.
+var exitCodes = []struct {
+	kind error
+	code int
+}{
+	{ErrBinaryNotFound, 3},
+	{ErrConnection, 4},
+	{ErrAuth, 5},
+	{ErrPermission, 6},
+	{ErrDiskFull, 7},
+}
+
+// ExitCode returns the process exit code for an error, detecting its category from
+// the underlying error or its message
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	err = classifyError(err)
+	for _, c := range exitCodes {
+		if errors.Is(err, c.kind) {
+			return c.code
+		}
+	}
+
+	return 1
+}
@@ -4,33 +4,40 @@ package utils
 
 import (
 	"fmt"
-	"path"
+	"path/filepath"
 	"syscall"
 )
 
 // HasEnoughSpace will return an error message if the provided location does not
 // have sufficient storage space
 func HasEnoughSpace(location string, requiredSize int64) error {
-	location = path.Join(location)
-	var stat syscall.Statfs_t
+	location = filepath.Join(location)
 
-	if err := syscall.Statfs(location, &stat); err != nil {
+	remainingBytes, err := FreeSpace(location)
+	if err != nil {
 		return err
 	}
 
-	// Available blocks * size per block = available space in bytes
-	remainingBytes := stat.Bavail * uint64(stat.Bsize)
-
-	storageExpected := uint64(requiredSize)
-
-	if storageExpected > remainingBytes {
-		return fmt.Errorf(
+	if requiredSize > remainingBytes {
+		return classify(ErrDiskFull, fmt.Errorf(
 			"'%s' does not have enough space available (+-%s required, %s available)",
 			location,
 			ByteToHr(requiredSize),
-			ByteToHr(int64(remainingBytes)),
-		)
+			ByteToHr(remainingBytes),
+		))
 	}
 
 	return nil
 }
+
+// FreeSpace returns the storage space available at the provided location
+func FreeSpace(location string) (int64, error) {
+	var stat syscall.Statfs_t
+
+	if err := syscall.Statfs(filepath.Join(location), &stat); err != nil {
+		return 0, err
+	}
+
+	// Available blocks * size per block = available space in bytes
+	return int64(stat.Bavail * uint64(stat.Bsize)), nil
+}
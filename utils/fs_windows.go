@@ -2,7 +2,14 @@
 
 package utils
 
+import "errors"
+
 // HasEnoughSpace does not work on Windows
 func HasEnoughSpace(path string, requiredSize int64) error {
 	return nil
 }
+
+// FreeSpace does not work on Windows
+func FreeSpace(path string) (int64, error) {
+	return 0, errors.New("Free space cannot be checked on Windows")
+}
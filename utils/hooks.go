@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// RunSQLHook runs the SQL of a hook (eg: pre-dump) in the database, with the same
+// connection settings as the dump or restore. Each SQL string may contain multiple
+// statements, and the hook stops at the first error.
+func RunSQLHook(db Database, hook string, statements []string) error {
+	for _, stmt := range statements {
+		app.Log(fmt.Sprintf("Running %s SQL: %s", hook, sqlSnippet(stmt)))
+
+		if err := db.ExecSQL(stmt); err != nil {
+			return fmt.Errorf("Error running %s SQL (%s): %s", hook, sqlSnippet(stmt), err.Error())
+		}
+	}
+
+	return nil
+}
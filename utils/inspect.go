@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Backups are inspected by streaming the SQL dump line by line, so only the current
+// line (read in chunks) is held in memory. Row counts are approximate, as they are
+// counted from the INSERT statements (or COPY data) rather than parsed as SQL.
+
+// BackupSummary describes the contents of a database dump
+type BackupSummary struct {
+	// Database is the name of the database, if known
+	Database string
+
+	// ServerVersion is the version of the database server dumped, if known
+	ServerVersion string
+
+	// Charset is the default charset & collation of the database, if known
+	Charset string
+
+	// SchemaOnly is whether the dump contains no data
+	SchemaOnly bool
+
+	// Tables are the tables in the dump, in order
+	Tables []TableSummary
+
+	// Bytes is the size of the uncompressed SQL read
+	Bytes int64
+
+	// Truncated is whether the dump ended unexpectedly, in which case the summary
+	// only describes the part which could be read
+	Truncated bool
+}
+
+// TableSummary describes a table in a database dump
+type TableSummary struct {
+	Name string
+	Rows int64
+}
+
+// Rows returns the total number of rows in the dump
+func (s BackupSummary) Rows() int64 {
+	var rows int64
+	for _, t := range s.Tables {
+		rows += t.Rows
+	}
+
+	return rows
+}
+
+// InspectBackup summarises the database dump of an sspak archive, or a compressed
+// SQL dump (eg: database.sql.gz), without restoring it
+func InspectBackup(file string) (BackupSummary, error) {
+	summary := BackupSummary{}
+
+	r, err := openBackup(file)
+	if err != nil {
+		return summary, err
+	}
+
+	defer func() {
+		if err := r.Close(); err != nil {
+			fmt.Printf("Error closing file: %s\n", err)
+		}
+	}()
+
+	br := bufio.NewReader(r)
+
+	// sspak archives are tar files, with the "ustar" magic at offset 257
+	header, _ := br.Peek(262)
+	if len(header) < 262 || string(header[257:262]) != "ustar" {
+		err := inspectDump(br, &summary)
+		return summary, inspectError(err, &summary)
+	}
+
+	found := false
+	tr := tar.NewReader(br)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return summary, inspectError(err, &summary)
+		}
+
+		switch hdr.Name {
+		case "database.sql.gz":
+			found = true
+			if err := inspectDump(tr, &summary); err != nil {
+				return summary, inspectError(err, &summary)
+			}
+		case ManifestFile:
+			var m Manifest
+			if err := json.NewDecoder(tr).Decode(&m); err == nil && m.Database != nil {
+				summary.Database = m.Database.Name
+			}
+		}
+	}
+
+	if !found {
+		return summary, fmt.Errorf("'%s' does not contain a database backup", file)
+	}
+
+	return summary, nil
+}
+
+// InspectError marks the summary as truncated if the dump ended unexpectedly,
+// returning any other error
+func inspectError(err error, summary *BackupSummary) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		summary.Truncated = true
+		return nil
+	}
+
+	return err
+}
+
+// InspectDump summarises a compressed SQL dump
+func inspectDump(r io.Reader, summary *BackupSummary) error {
+	reader, err := newDecompressReader(r)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	br := bufio.NewReaderSize(reader, 64*1024)
+
+	tables := map[string]int{}
+	table := func(name string) *TableSummary {
+		i, ok := tables[name]
+		if !ok {
+			i = len(summary.Tables)
+			tables[name] = i
+			summary.Tables = append(summary.Tables, TableSummary{Name: name})
+		}
+		return &summary.Tables[i]
+	}
+
+	// the table of the current INSERT statement (counted as it is read), and of
+	// the current PostgreSQL COPY block (counted per line)
+	var inserting, copying *TableSummary
+	counter := rowCounter{}
+	newLine := true
+
+	for {
+		chunk, isPrefix, err := br.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		summary.Bytes += int64(len(chunk))
+		if !isPrefix {
+			summary.Bytes++
+		}
+
+		if !newLine {
+			if inserting != nil {
+				inserting.Rows += counter.count(chunk)
+			}
+		} else if copying != nil {
+			if string(chunk) == `\.` {
+				copying = nil
+			} else {
+				copying.Rows++
+			}
+		} else {
+			line := string(chunk)
+			upper := strings.ToUpper(line)
+
+			switch {
+			case strings.HasPrefix(line, charsetPrefix):
+				summary.Charset = strings.Join(strings.Fields(strings.TrimPrefix(line, charsetPrefix)), " ")
+			case strings.HasPrefix(line, serverVersionPrefix):
+				summary.ServerVersion = strings.TrimSpace(strings.TrimPrefix(line, serverVersionPrefix))
+			case line == SchemaOnlyMarker:
+				summary.SchemaOnly = true
+			case strings.HasPrefix(line, "-- Host:") && strings.Contains(line, "Database: "):
+				// mysqldump header, eg: -- Host: localhost    Database: site
+				summary.Database = strings.TrimSpace(line[strings.Index(line, "Database: ")+len("Database: "):])
+			case strings.HasPrefix(upper, "CREATE TABLE "):
+				table(inspectTableName(line[len("CREATE TABLE "):]))
+			case strings.HasPrefix(upper, "INSERT INTO "):
+				inserting = table(inspectTableName(line[len("INSERT INTO "):]))
+				counter = rowCounter{}
+				values := chunk
+				if i := strings.Index(upper, " VALUES"); i >= 0 {
+					values = chunk[i+len(" VALUES"):]
+				}
+				inserting.Rows += counter.count(values)
+			case strings.HasPrefix(upper, "COPY ") && strings.HasSuffix(upper, "FROM STDIN;"):
+				copying = table(inspectTableName(line[len("COPY "):]))
+			}
+		}
+
+		newLine = !isPrefix
+		if newLine {
+			inserting = nil
+		}
+	}
+}
+
+// InspectTableName returns the (unquoted) table name at the start of a statement,
+// eg: `Member` VALUES ..., "public"."Member" (...) or IF NOT EXISTS Member (...)
+func inspectTableName(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(strings.ToUpper(s), "IF NOT EXISTS ") {
+		s = strings.TrimSpace(s[len("IF NOT EXISTS "):])
+	}
+
+	var name strings.Builder
+	var quote rune
+	for _, c := range s {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			name.WriteRune(c)
+		case c == '`' || c == '"':
+			quote = c
+		case c == ' ' || c == '(' || c == ';':
+			return name.String()
+		default:
+			name.WriteRune(c)
+		}
+	}
+
+	return name.String()
+}
+
+// RowCounter counts the rows of an INSERT statement, eg: (1,'a'),(2,'b'), which may
+// be split across multiple chunks. Quoted strings (with backslash escapes) are skipped.
+type rowCounter struct {
+	depth   int
+	inQuote bool
+	escaped bool
+}
+
+func (rc *rowCounter) count(b []byte) int64 {
+	var rows int64
+
+	for len(b) > 0 {
+		if rc.escaped {
+			rc.escaped = false
+			b = b[1:]
+			continue
+		}
+
+		if rc.inQuote {
+			i := bytes.IndexAny(b, `\'`)
+			if i < 0 {
+				return rows
+			}
+			if b[i] == '\\' {
+				rc.escaped = true
+			} else {
+				rc.inQuote = false
+			}
+			b = b[i+1:]
+			continue
+		}
+
+		switch b[0] {
+		case '\'':
+			rc.inQuote = true
+		case '(':
+			if rc.depth == 0 {
+				rows++
+			}
+			rc.depth++
+		case ')':
+			if rc.depth > 0 {
+				rc.depth--
+			}
+		}
+		b = b[1:]
+	}
+
+	return rows
+}
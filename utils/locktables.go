@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// MySQLLockTables locks all the (not ignored) tables of the database for reading on a
+// single dedicated connection, and returns a function to unlock them & release it.
+// LOCK TABLES would end the dump's transaction if run in the same session, so the
+// locks are held by this connection for the whole dump instead. They are taken before
+// the dump starts its transaction, and block writes from every other session, so its
+// snapshot sees the same data as the locked (including MyISAM) tables.
+func mysqlLockTables(ctx context.Context, db *sql.DB, ignoreTables []string) (func() error, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := mysqlBaseTables(ctx, conn)
+	if err != nil {
+		conn.Close() // #nosec
+		return nil, err
+	}
+
+	locks := []string{}
+	for _, table := range tables {
+		if !InSlice(table, ignoreTables) {
+			locks = append(locks, "`"+strings.Replace(table, "`", "``", -1)+"` READ")
+		}
+	}
+
+	if len(locks) > 0 {
+		if _, err := conn.ExecContext(ctx, "LOCK TABLES "+strings.Join(locks, ", ")); err != nil {
+			conn.Close() // #nosec
+			return nil, err
+		}
+	}
+
+	unlocked := false
+
+	return func() error {
+		if unlocked {
+			return nil
+		}
+		unlocked = true
+
+		_, err := conn.ExecContext(context.Background(), "UNLOCK TABLES")
+		if cerr := conn.Close(); err == nil {
+			err = cerr
+		}
+
+		return err
+	}, nil
+}
+
+// MySQLBaseTables returns the names of the tables (not views) of the current database
+func mysqlBaseTables(ctx context.Context, conn *sql.Conn) ([]string, error) {
+	tables := []string{}
+
+	rows, err := conn.QueryContext(ctx, "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE'")
+	if err != nil {
+		return tables, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return tables, err
+		}
+		tables = append(tables, table)
+	}
+
+	return tables, rows.Err()
+}
+
+// MySQLWarnNonTransactional warns about the tables which are not part of the dump's
+// consistent snapshot because their engine (eg: MyISAM) is not transactional. With
+// --replica-safe these cannot be made consistent with --lock-tables.
+func mysqlWarnNonTransactional(db *sql.DB, tables []string) {
+	rows, err := queryStrings(db, "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE' AND ENGINE <> 'InnoDB'")
+	if err != nil {
+		app.Log(fmt.Sprintf("Could not check the table engines: %s", err.Error()))
+		return
+	}
+
+	found := []string{}
+	for _, table := range rows {
+		if InSlice(table, tables) {
+			found = append(found, table)
+		}
+	}
+
+	if len(found) > 0 && !app.Quiet {
+		fmt.Printf("Warning: tables %s are not transactional, so they are not part of the consistent snapshot\n", strings.Join(found, ", "))
+	}
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// ManifestFile is the name of the manifest within an sspak archive. It is the last
+// file in the archive, and is ignored by other sspak tools.
+const ManifestFile = "manifest.json"
+
+// Manifest describes the contents of an sspak archive
+type Manifest struct {
+	// Version is the ssbak version which created the backup
+	Version string `json:"ssbakVersion"`
+
+	// Created is when the backup was created
+	Created time.Time `json:"created"`
+
+	// Database describes the database dump, if any
+	Database *ManifestDatabase `json:"database,omitempty"`
+
+	// Files are the files in the archive
+	Files []ManifestEntry `json:"files"`
+}
+
+// ManifestDatabase describes the database dump of an sspak archive
+type ManifestDatabase struct {
+	Type          string   `json:"type"`
+	Name          string   `json:"name"`
+	ServerVersion string   `json:"serverVersion,omitempty"`
+	Charset       string   `json:"charset,omitempty"`
+	Tables        int      `json:"tables,omitempty"`
+	TableNames    []string `json:"tableNames,omitempty"`
+	SchemaOnly    bool     `json:"schemaOnly,omitempty"`
+	DataOnly      []string `json:"dataOnly,omitempty"`
+	Codec         string   `json:"codec"`
+	Encrypted     bool     `json:"encrypted,omitempty"`
+	Checksum      string   `json:"sha256"`
+}
+
+// ManifestEntry describes a file in an sspak archive
+type ManifestEntry struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+}
+
+// BuildManifest gathers the manifest of an sspak archive from the database dump
+// (nil if the database is not included) and the files to be archived
+func BuildManifest(version string, dump *DumpResult, files []string) (Manifest, error) {
+	m := Manifest{Version: version, Created: time.Now().UTC(), Files: []ManifestEntry{}}
+
+	if dump != nil {
+		m.Database = &ManifestDatabase{
+			Type:          app.DB.Type,
+			Name:          dump.Database,
+			ServerVersion: dump.ServerVersion,
+			Charset:       dump.Charset,
+			Tables:        dump.Tables,
+			TableNames:    dump.TableNames,
+			SchemaOnly:    app.SchemaOnly,
+			DataOnly:      app.DataOnlyTables,
+			Codec:         app.Codec,
+			Encrypted:     app.Encrypt,
+			Checksum:      dump.Checksum,
+		}
+	}
+
+	for _, file := range files {
+		size, err := CalcSize(file)
+		if err != nil {
+			return m, err
+		}
+		m.Files = append(m.Files, ManifestEntry{Name: filepath.Base(file), Bytes: size})
+	}
+
+	return m, nil
+}
+
+// WriteManifest writes a manifest to a JSON file
+func WriteManifest(m Manifest, file string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, append(b, '\n'), 0600)
+}
+
+// ReadManifest reads a manifest from a JSON file
+func ReadManifest(file string) (Manifest, error) {
+	var m Manifest
+
+	b, err := ioutil.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return m, err
+	}
+
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("Invalid manifest '%s': %s", file, err.Error())
+	}
+
+	return m, nil
+}
+
+// CheckDatabase returns an error if the database dump cannot be restored to a
+// database of the given type
+func (m Manifest) CheckDatabase(dbType string) error {
+	if m.Database == nil || m.Database.Type == "" || m.Database.Type == dbType {
+		return nil
+	}
+
+	return fmt.Errorf("Backup is of a %s database, and cannot be restored to a %s database", m.Database.Type, dbType)
+}
+
+// Summary returns a human readable summary of the backup, eg: Backup created
+// 2024-01-02 03:04 UTC by ssbak 1.2.3: MySQL database 'site' (8.0.36, 42 tables), assets (1.2GiB)
+func (m Manifest) Summary() string {
+	parts := []string{}
+
+	if m.Database != nil {
+		details := []string{}
+		if m.Database.ServerVersion != "" {
+			details = append(details, m.Database.ServerVersion)
+		}
+		if m.Database.Tables > 0 {
+			details = append(details, fmt.Sprintf("%d tables", m.Database.Tables))
+		}
+		if m.Database.SchemaOnly {
+			details = append(details, "schema only")
+		}
+		db := fmt.Sprintf("%s database '%s'", m.Database.Type, m.Database.Name)
+		if len(details) > 0 {
+			db += " (" + strings.Join(details, ", ") + ")"
+		}
+		parts = append(parts, db)
+	}
+
+	for _, f := range m.Files {
+		if f.Name == "assets.tar.gz" {
+			parts = append(parts, fmt.Sprintf("assets (%s)", ByteToHr(f.Bytes)))
+		}
+	}
+
+	return fmt.Sprintf(
+		"Backup created %s by ssbak %s: %s",
+		m.Created.Format("2006-01-02 15:04 MST"), m.Version, strings.Join(parts, ", "),
+	)
+}
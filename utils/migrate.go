@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// Migrate copies the database of the src connection to the dst connection (of the
+// same type), by dumping it to a compressed file in dir which is then restored. The
+// target database is created if it does not exist, optionally dropping it first.
+// The source charset & time zone are applied to the target as with any restore.
+// MySQL databases can be streamed directly into the target (see MigrateStream).
+func Migrate(src, dst app.DBStruct, dir string, dropDatabase bool) (LoadResult, error) {
+	if src.Type != dst.Type {
+		return LoadResult{}, fmt.Errorf("Cannot migrate a %s database to a %s database", src.Type, dst.Type)
+	}
+
+	if src.Host == dst.Host && src.Port == dst.Port && src.Socket == dst.Socket && src.Path == dst.Path && src.Name == dst.Name {
+		return LoadResult{}, errors.New("The source & target databases are the same")
+	}
+
+	if app.MigrateStream {
+		if src.Type != "MySQL" {
+			return LoadResult{}, fmt.Errorf("Streaming migrations are not supported for %s databases", src.Type)
+		}
+		return mysqlMigrateStream(app.Context(), src, dst, dropDatabase)
+	}
+
+	source, err := NewDatabase(src)
+	if err != nil {
+		return LoadResult{}, err
+	}
+
+	target, err := NewDatabase(dst)
+	if err != nil {
+		return LoadResult{}, err
+	}
+
+	gzipFile := filepath.Join(dir, "migrate.sql.gz")
+	app.AddTempFile(gzipFile)
+
+	dump, err := source.DumpToGz(gzipFile)
+	if err != nil {
+		return LoadResult{}, err
+	}
+
+	if dst.Type == "MySQL" {
+		if err := mysqlMigrateCompat(dst, dump.ServerVersion); err != nil {
+			return LoadResult{}, err
+		}
+	}
+
+	if err := target.CreateDB(dropDatabase); err != nil {
+		return LoadResult{}, err
+	}
+
+	return target.LoadFromGz(gzipFile)
+}
+
+// MySQLMigrateStream streams the dump of the src database directly into the dst
+// database, without an intermediate file. The dump is compressed with app.Codec
+// (none by default) as it passes through. If either side fails the other is stopped,
+// and the dump error (the likely cause) is returned before the restore error.
+func mysqlMigrateStream(ctx context.Context, src, dst app.DBStruct, dropDatabase bool) (LoadResult, error) {
+	start := time.Now()
+
+	config, err := mysqlConfig(src)
+	if err != nil {
+		return LoadResult{}, err
+	}
+
+	if app.TZUTC {
+		config.Params["time_zone"] = "'" + utcTimeZone + "'"
+	}
+
+	srcDB, err := sql.Open(mysqlDriver, config.FormatDSN())
+	if err != nil {
+		return LoadResult{}, fmt.Errorf("Error opening database: %s", err.Error())
+	}
+
+	defer srcDB.Close()
+
+	var sourceVersion string
+	if err := srcDB.QueryRow("SELECT VERSION()").Scan(&sourceVersion); err != nil {
+		return LoadResult{}, classifyError(fmt.Errorf("Cannot connect to the source database: %s", err.Error()))
+	}
+
+	ignoreTables, err := mysqlExcludedTables(srcDB)
+	if err != nil {
+		return LoadResult{}, err
+	}
+
+	source := src.Name
+
+	if err := mysqlMigrateCompat(dst, sourceVersion); err != nil {
+		return LoadResult{}, err
+	}
+
+	if err := MySQLCreateDB(dst, dropDatabase); err != nil {
+		return LoadResult{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	dumpErr := make(chan error, 1)
+
+	app.LogEvent("migrate_started", fmt.Sprintf("Streaming database '%s' to '%s'", source, dst.Name), "source", source, "database", dst.Name)
+
+	go func() {
+		err := mysqlDumpStream(ctx, srcDB, src, pw, nil, ignoreTables, newProgressCounter("Dumped"))
+		if err != nil {
+			err = fmt.Errorf("Error dumping: %s", err.Error())
+		}
+		// the error is sent before closing the pipe, so is known once the restore fails
+		dumpErr <- err
+		pw.CloseWithError(err) // #nosec
+	}()
+
+	result, err := mysqlMigrateLoad(ctx, dst, pr, source)
+	if err != nil {
+		select {
+		case e := <-dumpErr:
+			if e != nil {
+				return LoadResult{}, classifyError(e)
+			}
+		default:
+			// stop the dump, which is blocked writing to the pipe
+			cancel()
+			pr.CloseWithError(err) // #nosec
+			<-dumpErr
+		}
+
+		return LoadResult{}, classifyError(err)
+	}
+
+	if err := <-dumpErr; err != nil {
+		return LoadResult{}, classifyError(err)
+	}
+
+	result.Duration = time.Since(start)
+	app.LogEvent(
+		"migrate_completed", fmt.Sprintf("Streamed database '%s' to '%s' (%s in %s)", source, dst.Name, ByteToHr(result.Bytes), result.Duration.Round(time.Millisecond)),
+		"source", source, "database", dst.Name, "bytes", result.Bytes, "duration", result.Duration.Seconds(),
+	)
+
+	return result, nil
+}
+
+// MySQLMigrateLoad decompresses & imports the streamed dump
+func mysqlMigrateLoad(ctx context.Context, dst app.DBStruct, r io.Reader, source string) (LoadResult, error) {
+	reader, err := newDecompressReader(r)
+	if err != nil {
+		return LoadResult{}, err
+	}
+	defer reader.Close()
+
+	return mysqlLoadStream(ctx, dst, reader, source)
+}
+
+// MySQLMigrateCompat enables the MySQL 8 collation rewrites (see app.Compat) when
+// migrating from MySQL 8 to the MariaDB dst server
+func mysqlMigrateCompat(dst app.DBStruct, sourceVersion string) error {
+	targetVersion, err := mysqlServerVersion(dst)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	app.Log(fmt.Sprintf("Source server version %s, target server version %s", sourceVersion, targetVersion))
+
+	if !app.Compat && mysqlVariant(sourceVersion) == "MySQL" && mysqlMajorVersion(sourceVersion) >= 8 && mysqlVariant(targetVersion) == "MariaDB" {
+		app.Log("Rewriting MySQL 8 collations for MariaDB")
+		app.Compat = true
+	}
+
+	return nil
+}
+
+// MySQLServerVersion returns the version of the conf MySQL server
+func mysqlServerVersion(conf app.DBStruct) (string, error) {
+	config, err := mysqlConfig(conf)
+	if err != nil {
+		return "", err
+	}
+	config.DBName = "" // the database may not exist yet
+
+	db, err := sql.Open(mysqlDriver, config.FormatDSN())
+	if err != nil {
+		return "", fmt.Errorf("Error opening database: %s", err.Error())
+	}
+
+	defer db.Close()
+
+	if err := waitForMySQL(db, app.WaitTimeout); err != nil {
+		return "", err
+	}
+
+	var version string
+	err = db.QueryRow("SELECT VERSION()").Scan(&version)
+
+	return version, err
+}
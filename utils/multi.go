@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// DatabaseDump is the result of dumping one of multiple databases
+type DatabaseDump struct {
+	// Name is the name of the database
+	Name string
+
+	// Result is the dump result, if successful
+	Result DumpResult
+
+	// Err is the error dumping the database, if any
+	Err error
+}
+
+// DumpAll dumps each of the named databases into <dir>/<name>.sql.gz, using the
+// connection settings of conf. A failure does not stop the remaining databases
+// being dumped, instead the errors are joined & returned once all are done.
+func DumpAll(conf app.DBStruct, names []string, dir string) ([]DatabaseDump, error) {
+	dumps := []DatabaseDump{}
+	errs := []error{}
+
+	for _, name := range names {
+		named := conf
+		named.Name = name
+
+		db, err := NewDatabase(named)
+		if err != nil {
+			return dumps, err
+		}
+
+		app.Log(fmt.Sprintf("Dumping database '%s'", name))
+
+		gzipFile := filepath.Join(dir, name+".sql.gz")
+		app.AddTempFile(gzipFile)
+
+		err = RunSQLHook(db, "pre-dump", app.PreDumpSQL)
+		var result DumpResult
+		if err == nil {
+			result, err = db.DumpToGz(gzipFile)
+		}
+		if err != nil {
+			err = fmt.Errorf("Error dumping database '%s': %w", name, err)
+			errs = append(errs, err)
+		}
+
+		dumps = append(dumps, DatabaseDump{Name: name, Result: result, Err: err})
+	}
+
+	return dumps, errors.Join(errs...)
+}
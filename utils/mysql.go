@@ -2,122 +2,747 @@ package utils
 
 import (
 	"bufio"
-	"compress/gzip"
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/aliakseiz/go-mysqldump"
 	"github.com/axllent/ssbak/app"
 	"github.com/go-sql-driver/mysql"
 )
 
-func mysqlConfig() *mysql.Config {
-	addr := app.DB.Host
-	if app.DB.Port != "" {
-		addr += ":" + app.DB.Port
+// MySQLDriver is the database/sql driver used for MySQL connections
+var mysqlDriver = "mysql"
+
+// DBHost returns the conf host, without the brackets of an IPv6 literal (eg: [::1])
+func dbHost(conf app.DBStruct) string {
+	host := conf.Host
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
 	}
 
+	return host
+}
+
+// MySQLInsertSize returns the maximum size of the multi-row INSERT statements of dumps,
+// or 1 to write each row as its own INSERT statement (--skip-extended-insert)
+func mysqlInsertSize() int {
+	if !app.ExtendedInsert {
+		return 1
+	}
+
+	return int(app.NetBufferLength)
+}
+
+// MySQLConfig returns the driver config for the conf connection settings
+func mysqlConfig(conf app.DBStruct) (*mysql.Config, error) {
+	port := conf.Port
+	if port == "" {
+		port = "3306"
+	}
+	// IPv6 hosts are bracketed, eg: [::1]:3306
+	addr := net.JoinHostPort(dbHost(conf), port)
+
 	// Open connection to database
 	config := mysql.NewConfig()
-	config.User = app.DB.Username
-	config.Passwd = app.DB.Password
-	config.DBName = app.DB.Name
+	config.User = conf.Username
+	config.Passwd = conf.Password
+	config.DBName = conf.Name
 	config.Net = "tcp"
 	config.Addr = addr
+	config.Params = map[string]string{"charset": conf.Charset}
+	config.Timeout = conf.ConnectTimeout
+	config.MaxAllowedPacket = int(app.MaxAllowedPacket)
+
+	if conf.Socket != "" {
+		// connect via unix socket, ignoring host & port
+		config.Net = "unix"
+		config.Addr = conf.Socket
+	}
 
-	return config
+	tlsConfig, err := mysqlTLSConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	config.TLSConfig = tlsConfig
+
+	logMySQLConfig(config)
+
+	return config, nil
 }
 
-// MySQLDumpToGz uses mysqldump to stream a database dump directly into a gzip file
-func MySQLDumpToGz(gzipFile string) error {
-	config := mysqlConfig()
+// MySQLDumpToGz streams a database dump directly into a compressed (gzip or zstd) file,
+// returning the file, size, checksum & duration of the dump
+func MySQLDumpToGz(conf app.DBStruct, gzipFile string) (DumpResult, error) {
+	return MySQLDumpToGzContext(app.Context(), conf, gzipFile)
+}
 
-	f, err := os.Create(path.Clean(gzipFile))
-	if err != nil {
-		return fmt.Errorf("Error creating database backup: %s", err.Error())
+// MySQLDumpToGzContext is MySQLDumpToGz with cancellation. The dump is aborted on the
+// next write once the context is done, and the incomplete file is removed.
+// Dumps failing with a transient (connection) error are retried up to app.DumpRetries
+// times, starting over each time.
+func MySQLDumpToGzContext(ctx context.Context, conf app.DBStruct, gzipFile string) (DumpResult, error) {
+	backoff := 5 * time.Second
+
+	for attempt := 1; ; attempt++ {
+		result, err := mysqlDumpToGz(ctx, conf, gzipFile)
+		if err == nil || attempt > app.DumpRetries || ctx.Err() != nil || !isTransientError(err) {
+			return result, classifyError(err)
+		}
+
+		app.LogEvent(
+			"dump_retry", fmt.Sprintf("Dump attempt %d failed (%s), retrying in %s", attempt, err.Error(), backoff),
+			"attempt", attempt, "error", err.Error(),
+		)
+
+		select {
+		case <-ctx.Done():
+			return DumpResult{}, fmt.Errorf("Database dump cancelled: %s", ctx.Err().Error())
+		case <-time.After(backoff):
+		}
+
+		if backoff < time.Minute {
+			backoff = backoff * 2
+		}
 	}
+}
 
-	defer func() {
-		if err := f.Close(); err != nil {
-			fmt.Printf("Error closing file: %s\n", err)
+// TransientErrors are (lowercase) messages of errors which may succeed if retried,
+// such as lost connections, as opposed to authentication or permission errors
+var transientErrors = []string{
+	"broken pipe",
+	"connection reset",
+	"connection refused",
+	"bad connection",
+	"invalid connection",
+	"lost connection",
+	"server has gone away",
+	"i/o timeout",
+	"unexpected eof",
+}
+
+// IsTransientError returns whether an error looks transient, and may succeed if retried
+func isTransientError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, e := range transientErrors {
+		if strings.Contains(msg, e) {
+			return true
 		}
-	}()
+	}
+
+	return false
+}
+
+// MySQLDumpToGz makes a single attempt to dump the database to gzipFile
+func mysqlDumpToGz(ctx context.Context, conf app.DBStruct, gzipFile string) (DumpResult, error) {
+	start := time.Now()
+
+	config, err := mysqlConfig(conf)
+	if err != nil {
+		return DumpResult{}, err
+	}
+
+	if app.TZUTC {
+		// dump TIMESTAMP columns in UTC (applied to every connection)
+		config.Params["time_zone"] = "'" + utcTimeZone + "'"
+	}
+
+	// dump to a temporary file which is only renamed once complete & verified,
+	// so gzipFile never holds a partial dump
+	tmpFile := gzipFile + ".tmp"
+	app.AddTempFile(tmpFile)
+
+	f, err := os.Create(filepath.Clean(tmpFile))
+	if err != nil {
+		return DumpResult{}, fmt.Errorf("Error creating database backup: %s", err.Error())
+	}
+
+	// the file is closed explicitly once the dump is complete, this only handles early
+	// returns, after which the temporary file is removed (a no-op once it is renamed)
+	defer os.Remove(tmpFile) // #nosec
+	defer f.Close()          // #nosec
+
+	// hash the dump as it is written
+	h := sha256.New()
 
 	// Open connection to database
-	db, err := sql.Open("mysql", config.FormatDSN())
+	db, err := sql.Open(mysqlDriver, config.FormatDSN())
 	if err != nil {
-		return fmt.Errorf("Error opening database: %s", err.Error())
+		return DumpResult{}, fmt.Errorf("Error opening database: %s", err.Error())
 	}
 
 	defer db.Close()
 
-	gzw := gzip.NewWriter(f)
+	app.LogEvent("dump_started", fmt.Sprintf("Dumping database to '%s'", gzipFile), "file", gzipFile)
+
+	ignoreTables, err := mysqlExcludedTables(db)
+	if err != nil {
+		return DumpResult{}, fmt.Errorf("Error dumping: %s", err.Error())
+	}
+
+	var dataSize int64
+	tables := []string{}
+	for table, size := range mysqlTableSizes(db) {
+		if InSlice(table, ignoreTables) || (len(app.DataOnlyTables) > 0 && !InSlice(table, app.DataOnlyTables)) {
+			continue
+		}
+		tables = append(tables, table)
+		if !app.SchemaOnly {
+			dataSize += size
+		}
+	}
+	sort.Strings(tables)
+
+	if app.ReplicaSafe {
+		mysqlLogReplicaStatus(db)
+		mysqlWarnNonTransactional(db, tables)
+	}
+
+	// parallel dumps are written to parts before being combined
+	if app.Parallel > 1 {
+		dataSize *= 2
+	}
+	if err := checkDumpSpace(filepath.Dir(tmpFile), dataSize); err != nil {
+		return DumpResult{}, err
+	}
+
+	// the uncompressed SQL is optionally kept as well, written to a temporary file which
+	// is only renamed once the dump is complete
+	var sqlFile *os.File
+	var plain io.Writer
+	if app.KeepSQL != "" {
+		sqlFile, err = os.Create(filepath.Clean(app.KeepSQL + ".tmp"))
+		if err != nil {
+			return DumpResult{}, fmt.Errorf("Error creating '%s': %s", app.KeepSQL, err.Error())
+		}
+		app.AddTempFile(sqlFile.Name())
+
+		defer os.Remove(sqlFile.Name()) // #nosec
+		defer sqlFile.Close()           // #nosec
+		plain = sqlFile
+	}
+
+	// the uncompressed size of the dump
+	counter := newProgressCounter("Dumped")
+
+	if app.Parallel > 1 && len(app.DataOnlyTables) == 0 && !app.SchemaOnly {
+		err = mysqlDumpParallel(ctx, db, conf, io.MultiWriter(f, h), filepath.Dir(tmpFile), ignoreTables, counter)
+	} else {
+		err = mysqlDumpStream(ctx, db, conf, io.MultiWriter(f, h), plain, ignoreTables, counter)
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			// the incomplete backup is removed on return
+			return DumpResult{}, fmt.Errorf("Database dump cancelled: %s", ctx.Err().Error())
+		}
+		return DumpResult{}, fmt.Errorf("Error dumping: %s", err.Error())
+	}
+
+	// both files are synced before either is renamed, so a failure leaves neither (the
+	// temporary files are removed on return)
+	if err := syncClose(f); err != nil {
+		return DumpResult{}, fmt.Errorf("Error closing database backup: %s", err.Error())
+	}
+
+	if sqlFile != nil {
+		if err := syncClose(sqlFile); err != nil {
+			return DumpResult{}, fmt.Errorf("Error closing '%s': %s", app.KeepSQL, err.Error())
+		}
+	}
+
+	if err := verifyDump(tmpFile); err != nil {
+		return DumpResult{}, err
+	}
+
+	if err := os.Rename(tmpFile, gzipFile); err != nil {
+		return DumpResult{}, fmt.Errorf("Error saving database backup: %s", err.Error())
+	}
+
+	if sqlFile != nil {
+		if err := os.Rename(sqlFile.Name(), app.KeepSQL); err != nil {
+			os.Remove(gzipFile) // #nosec
+			return DumpResult{}, fmt.Errorf("Error saving '%s': %s", app.KeepSQL, err.Error())
+		}
+	}
+
+	outSize, _ := CalcSize(gzipFile)
+	result := DumpResult{Path: gzipFile, Database: conf.Name, Bytes: outSize, Checksum: fmt.Sprintf("%x", h.Sum(nil)), Duration: time.Since(start), Tables: len(tables), TableNames: tables, UncompressedBytes: counter.bytes}
+
+	if sqlFile != nil {
+		result.SQLFile = app.KeepSQL
+		result.SQLBytes, _ = CalcSize(app.KeepSQL)
+		app.LogEvent(
+			"sql_kept", fmt.Sprintf("Wrote uncompressed SQL '%s' (%s)", app.KeepSQL, ByteToHr(result.SQLBytes)),
+			"file", app.KeepSQL, "bytes", result.SQLBytes,
+		)
+	}
+	logCompression(result)
+	app.Log(fmt.Sprintf("Dumped %d tables: %s", len(tables), strings.Join(tables, ", ")))
+	app.LogEvent(
+		"dump_completed", fmt.Sprintf("Wrote %s (%s)", gzipFile, result),
+		"file", gzipFile, "bytes", outSize, "sha256", result.Checksum, "duration", result.Duration.Seconds(), "throughput", result.Throughput(),
+	)
+
+	// server details for the manifest, which are not required for the dump itself
+	if err := db.QueryRow("SELECT VERSION()").Scan(&result.ServerVersion); err != nil {
+		app.Log(fmt.Sprintf("Unable to read the server version: %s", err.Error()))
+	}
+	if charset, collation, err := detectCharset(db); err == nil {
+		result.Charset = strings.TrimSpace(charset + " " + collation)
+	}
+
+	return result, nil
+}
+
+// MySQLDumpStream dumps the database as a single compressed stream to w, and the
+// uncompressed SQL to plain (if not nil)
+func mysqlDumpStream(ctx context.Context, db *sql.DB, conf app.DBStruct, w, plain io.Writer, ignoreTables []string, counter *progressCounter) error {
+	gzw, err := newCompressWriter(w)
+	if err != nil {
+		return err
+	}
 	defer gzw.Close()
-	defer gzw.Flush()
 
-	app.Log(fmt.Sprintf("Dumping database to '%s'", gzipFile))
+	columns, err := anonymiseColumns(db)
+	if err != nil {
+		return err
+	}
+
+	var sink io.Writer = gzw
+	if plain != nil {
+		sink = io.MultiWriter(gzw, plain)
+	}
+
+	tables := newTableProgressWriter(sink)
+	out := newAnonymiseWriter(&progressWriter{newRateLimitWriter(&contextWriter{ctx, tables}), counter}, columns)
 
 	dumper := mysqldump.Data{
 		Connection:       db,
-		Out:              gzw,
-		MaxAllowedPacket: 512000, // 512KB
+		Out:              out,
+		MaxAllowedPacket: mysqlInsertSize(),
+		IgnoreTables:     ignoreTables,
 	}
 
+	if len(app.DataOnlyTables) == 0 {
+		if err := writeMySQLCharset(db, out, conf.Charset); err != nil {
+			return err
+		}
+	}
+
+	if err := writeMySQLTimeZone(out); err != nil {
+		return err
+	}
+
+	// tables locked with --lock-tables are unlocked once the dump is complete
+	unlock := func() error { return nil }
+
 	// Dump database to file
-	if err = dumper.Dump(); err != nil {
-		return fmt.Errorf("Error dumping: %s", err.Error())
+	if len(app.DataOnlyTables) > 0 {
+		app.Log(fmt.Sprintf("Dumping data only for tables: %s", strings.Join(app.DataOnlyTables, ", ")))
+		err = mysqlDumpData(&dumper, app.DataOnlyTables, conf.Charset)
+	} else if app.SchemaOnly {
+		app.Log("Dumping database schema only (no data)")
+		err = mysqlDumpSchema(&dumper, conf.Charset)
+	} else {
+		// tables with a --where condition are dumped separately
+		dumper.IgnoreTables = append(append([]string{}, ignoreTables...), whereTables()...)
+
+		if app.LockTables {
+			app.Log("Locking all tables for reading during the dump")
+			if unlock, err = mysqlLockTables(ctx, db, ignoreTables); err != nil {
+				return fmt.Errorf("Error locking tables: %s", err.Error())
+			}
+			defer unlock() // #nosec
+		}
+
+		err = dumper.Dump()
+		if err == nil && len(app.Where) > 0 {
+			err = mysqlDumpWhere(db, out, ignoreTables)
+		}
 	}
 
-	outSize, _ := CalcSize(gzipFile)
-	app.Log(fmt.Sprintf("Wrote %s (%s)", gzipFile, ByteToHr(outSize)))
+	if err == nil && app.IncludeRoutines && len(app.DataOnlyTables) == 0 {
+		err = mysqlDumpRoutines(db, out)
+	}
+
+	if err == nil {
+		err = unlock()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+	tables.Close() // #nosec
+
+	// Close the compressed stream before verifying
+	return gzw.Close()
+}
+
+// MySQLDumpSchema writes the table structures (without data) to the dumper output.
+// The data is skipped entirely rather than filtered, so no rows are read.
+func mysqlDumpSchema(dumper *mysqldump.Data, charset string) error {
+	if err := dumper.Begin(); err != nil {
+		return err
+	}
+
+	tables, err := dumper.GetTables()
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(dumper.Out, "%s\nSET NAMES %s;\n", SchemaOnlyMarker, charset); err != nil {
+		return err
+	}
+
+	for _, name := range tables {
+		table := dumper.CreateTable(name)
+
+		create, err := table.CreateSQL()
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(
+			dumper.Out,
+			"\n--\n-- Table structure for table %s\n--\n\nDROP TABLE IF EXISTS %s;\n%s;\n",
+			table.NameEsc(),
+			table.NameEsc(),
+			create,
+		); err != nil {
+			return err
+		}
+	}
 
-	// Close dumper, connected database and file stream.
-	return dumper.Close()
+	return nil
+}
+
+// MySQLDumpData writes the data (without table structures) of the given tables to the
+// dumper output, returning an error if any of the tables do not exist
+func mysqlDumpData(dumper *mysqldump.Data, tables []string, charset string) error {
+	if err := dumper.Begin(); err != nil {
+		return err
+	}
+
+	existing, err := dumper.GetTables()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range tables {
+		found := false
+		for _, t := range existing {
+			if t == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Table '%s' does not exist", name)
+		}
+	}
+
+	if _, err := fmt.Fprintf(dumper.Out, "SET NAMES %s;\nSET FOREIGN_KEY_CHECKS=0;\n", charset); err != nil {
+		return err
+	}
+
+	for _, name := range tables {
+		table := dumper.CreateTable(name)
+
+		if _, err := fmt.Fprintf(dumper.Out, "\n--\n-- Dumping data for table %s\n--\n\n", table.NameEsc()); err != nil {
+			return err
+		}
+
+		if where, ok := app.Where[name]; ok {
+			app.Log(fmt.Sprintf("Dumping rows of '%s' where %s", name, where))
+			if err := mysqlWriteRows(dumper.Connection, dumper.Out, name, where); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// drain the stream on a write error, else the row reader is left blocking
+		var writeErr error
+		for insert := range table.Stream() {
+			if writeErr == nil {
+				_, writeErr = fmt.Fprintln(dumper.Out, insert)
+			}
+		}
+
+		if writeErr != nil {
+			return writeErr
+		}
+
+		if table.Err != nil {
+			return table.Err
+		}
+	}
+
+	_, err = io.WriteString(dumper.Out, "\nSET FOREIGN_KEY_CHECKS=1;\n")
+
+	return err
+}
+
+// MySQLExcludedTables returns the database tables matching any of the ExcludeTables patterns
+func mysqlExcludedTables(db *sql.DB) ([]string, error) {
+	excluded := []string{}
+	if len(app.ExcludeTables) == 0 {
+		return excluded, nil
+	}
+
+	tables, err := queryStrings(db, "SHOW TABLES")
+	if err != nil {
+		return excluded, err
+	}
+
+	return mysqlMatchTables(tables, app.ExcludeTables)
+}
+
+// MySQLMatchTables returns the tables matching any of the (path.Match) patterns
+func mysqlMatchTables(tables, patterns []string) ([]string, error) {
+	excluded := []string{}
+
+	for _, table := range tables {
+		for _, pattern := range patterns {
+			matched, err := path.Match(pattern, table)
+			if err != nil {
+				return excluded, fmt.Errorf("Invalid table pattern '%s': %s", pattern, err.Error())
+			}
+			if matched {
+				app.Log(fmt.Sprintf("Excluding table '%s'", table))
+				excluded = append(excluded, table)
+				break
+			}
+		}
+	}
+
+	return excluded, nil
+}
+
+// WaitForDatabase waits up to the timeout for the MySQL server to accept connections
+func WaitForDatabase(conf app.DBStruct, timeout time.Duration) error {
+	config, err := mysqlConfig(conf)
+	if err != nil {
+		return err
+	}
+	config.DBName = "" // the database may not exist yet
+
+	db, err := sql.Open(mysqlDriver, config.FormatDSN())
+	if err != nil {
+		return fmt.Errorf("Error opening database: %s", err.Error())
+	}
+
+	defer db.Close()
+
+	return waitForMySQL(db, timeout)
+}
+
+// WaitForMySQL retries `SELECT 1` with an increasing backoff until it succeeds or the
+// timeout is reached. Errors returned by the server itself (eg: access denied) are
+// returned immediately as the server is up, and retrying will not help.
+func waitForMySQL(db *sql.DB, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := 250 * time.Millisecond
+
+	for {
+		_, err := db.Exec("SELECT 1")
+		if err == nil {
+			return nil
+		}
+
+		if _, ok := err.(*mysql.MySQLError); ok || time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("Error connecting to database: %s", err.Error())
+		}
+
+		app.Log(fmt.Sprintf("Database not ready (%s), retrying in %s", err.Error(), backoff))
+		time.Sleep(backoff)
+
+		if backoff < 4*time.Second {
+			backoff = backoff * 2
+		}
+	}
+}
+
+// MySQLTestConnection verifies the connection settings, distinguishing between a server
+// which cannot be connected to, failed authentication, and a database which does not exist
+func MySQLTestConnection(conf app.DBStruct) error {
+	return classifyError(mysqlTestConnection(conf))
+}
+
+// MySQLTestConnection verifies the connection settings (see MySQLTestConnection)
+func mysqlTestConnection(conf app.DBStruct) error {
+	config, err := mysqlConfig(conf)
+	if err != nil {
+		return err
+	}
+	config.DBName = "" // check the database separately
+
+	db, err := sql.Open(mysqlDriver, config.FormatDSN())
+	if err != nil {
+		return fmt.Errorf("Error opening database: %s", err.Error())
+	}
+
+	defer db.Close()
+
+	server := config.Addr
+	app.Log(fmt.Sprintf("Connecting to MySQL server '%s' as '%s'", server, config.User))
+
+	var version string
+	if err := db.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+		if myErr, ok := err.(*mysql.MySQLError); ok && myErr.Number == 1045 {
+			return fmt.Errorf("Authentication failed for user '%s' on '%s': %s", config.User, server, err.Error())
+		}
+		return fmt.Errorf("Cannot connect to MySQL server '%s': %s", server, err.Error())
+	}
+
+	app.Log(fmt.Sprintf("Connected to server version %s", version))
+
+	var name string
+	err = db.QueryRow("SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", conf.Name).Scan(&name)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("Connected to MySQL server '%s', but database '%s' does not exist", server, conf.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := validateMySQLDatabaseName(conf.Name); err != nil {
+		return err
+	}
+
+	// connect to the database itself to confirm the user has access
+	if _, err := db.Exec("USE `" + conf.Name + "`"); err != nil {
+		return fmt.Errorf("Connected to MySQL server '%s', but cannot access database '%s': %s", server, conf.Name, err.Error())
+	}
+
+	return nil
+}
+
+// MySQLDatabaseNameRegex matches the database names which are safe to quote with
+// backticks in CREATE, DROP & USE statements
+var mysqlDatabaseNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_$-]{1,64}$`)
+
+// MySQLExecSQL runs one or more SQL statements in the database
+func MySQLExecSQL(conf app.DBStruct, statements string) error {
+	config, err := mysqlConfig(conf)
+	if err != nil {
+		return err
+	}
+	config.MultiStatements = true
+
+	db, err := sql.Open(mysqlDriver, config.FormatDSN())
+	if err != nil {
+		return fmt.Errorf("Error opening database: %s", err.Error())
+	}
+
+	defer db.Close()
+
+	if err := waitForMySQL(db, app.WaitTimeout); err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(app.Context(), statements)
+
+	return classifyError(err)
+}
+
+// ValidateMySQLDatabaseName returns an error if the database name contains characters
+// other than letters, digits, underscores, dashes & dollar signs, or is too long
+func validateMySQLDatabaseName(name string) error {
+	if !mysqlDatabaseNameRegex.MatchString(name) {
+		return fmt.Errorf("Invalid database name '%s' (must be 1-64 letters, digits, underscores, dashes or dollar signs)", name)
+	}
+
+	return nil
 }
 
 // MySQLCreateDB a database, optionally dropping it
-func MySQLCreateDB(dropDatabase bool) error {
-	config := mysqlConfig()
+func MySQLCreateDB(conf app.DBStruct, dropDatabase bool) error {
+	return classifyError(mysqlCreateDB(conf, dropDatabase))
+}
+
+// MySQLCreateDB creates a database (see MySQLCreateDB)
+func mysqlCreateDB(conf app.DBStruct, dropDatabase bool) error {
+	if err := validateMySQLDatabaseName(conf.Name); err != nil {
+		return err
+	}
+
+	config, err := mysqlConfig(conf)
+	if err != nil {
+		return err
+	}
 	config.DBName = "" // reset the database name
 
 	// Open connection to database
-	db, err := sql.Open("mysql", config.FormatDSN())
+	db, err := sql.Open(mysqlDriver, config.FormatDSN())
 	if err != nil {
 		return fmt.Errorf("Error opening database: %s", err.Error())
 	}
 
 	defer db.Close()
 
+	if err := waitForMySQL(db, app.WaitTimeout); err != nil {
+		return err
+	}
+
 	createMsg := `Creating database (if not exists)`
 
 	if dropDatabase {
-		app.Log(fmt.Sprintf("Dropping database '%s'", app.DB.Name))
-		if _, err := db.Exec("DROP DATABASE IF EXISTS `" + app.DB.Name + "`"); err != nil {
+		app.Log(fmt.Sprintf("Dropping database '%s'", conf.Name))
+		if _, err := db.Exec("DROP DATABASE IF EXISTS `" + conf.Name + "`"); err != nil {
 			return err
 		}
 		createMsg = `Creating database`
 	}
 
-	app.Log(fmt.Sprintf("%s '%s'", createMsg, app.DB.Name))
-	_, err = db.Exec("CREATE DATABASE IF NOT EXISTS `" + app.DB.Name + "`")
+	app.Log(fmt.Sprintf("%s '%s'", createMsg, conf.Name))
+	_, err = db.Exec("CREATE DATABASE IF NOT EXISTS `" + conf.Name + "`")
 
 	return err
 }
 
-// MySQLLoadFromGz loads a GZ database file into the database,
-// streaming the gz file to the mysql cli.
-func MySQLLoadFromGz(gzipSQLFile string) error {
+// MySQLLoadFromGz loads a compressed (gzip or zstd) database file into the database,
+// streaming the decompressed SQL statements to the server, and returning the amount
+// of SQL imported & the duration of the restore.
+func MySQLLoadFromGz(conf app.DBStruct, gzipSQLFile string) (LoadResult, error) {
+	return MySQLLoadFromGzContext(app.Context(), conf, gzipSQLFile)
+}
+
+// MySQLLoadFromGzContext is MySQLLoadFromGz with cancellation, aborting the
+// running statement once the context is done.
+func MySQLLoadFromGzContext(ctx context.Context, conf app.DBStruct, gzipSQLFile string) (LoadResult, error) {
+	result, err := mysqlLoadFromGz(ctx, conf, gzipSQLFile)
+
+	return result, classifyError(err)
+}
+
+// MySQLLoadFromGz loads a compressed database file (see MySQLLoadFromGzContext)
+func mysqlLoadFromGz(ctx context.Context, conf app.DBStruct, gzipSQLFile string) (LoadResult, error) {
+	start := time.Now()
+
 	if !IsFile(gzipSQLFile) {
-		return fmt.Errorf("File '%s' does not exist", gzipSQLFile)
+		return LoadResult{}, fmt.Errorf("File '%s' does not exist", gzipSQLFile)
 	}
 
 	f, err := os.Open(filepath.Clean(gzipSQLFile))
 	if err != nil {
-		return err
+		return LoadResult{}, err
 	}
 
 	defer func() {
@@ -126,65 +751,321 @@ func MySQLLoadFromGz(gzipSQLFile string) error {
 		}
 	}()
 
-	reader, err := gzip.NewReader(f)
+	var bar *progressBar
+	var in io.Reader = f
+	if app.ProgressBar && !app.Quiet {
+		inSize, _ := CalcSize(gzipSQLFile)
+		bar = newProgressBar(inSize)
+		in = &progressReader{f, bar}
+	}
+
+	reader, err := newDecompressReader(in)
 	if err != nil {
-		return err
+		return LoadResult{}, err
 	}
 	defer reader.Close()
 
-	config := mysqlConfig()
+	result, err := mysqlLoadStream(ctx, conf, reader, gzipSQLFile)
+	if err != nil {
+		return result, err
+	}
+
+	if bar != nil {
+		bar.finish()
+	}
+
+	result.Duration = time.Since(start)
+	app.LogEvent(
+		"restore_completed", fmt.Sprintf("Imported '%s' to '%s' (%s in %s)", gzipSQLFile, conf.Name, ByteToHr(result.Bytes), result.Duration.Round(time.Millisecond)),
+		"file", gzipSQLFile, "database", conf.Name, "bytes", result.Bytes, "duration", result.Duration.Seconds(),
+	)
+
+	return result, nil
+}
+
+// MySQLLoadStream imports the (decompressed) SQL statements of a dump read from r
+// into the database, source being the name of the dump for messages
+func mysqlLoadStream(ctx context.Context, conf app.DBStruct, r io.Reader, source string) (LoadResult, error) {
+	start := time.Now()
+
+	config, err := mysqlConfig(conf)
+	if err != nil {
+		return LoadResult{}, err
+	}
 
 	// Open connection to database
-	db, err := sql.Open("mysql", config.FormatDSN())
+	db, err := sql.Open(mysqlDriver, config.FormatDSN())
 	if err != nil {
-		return fmt.Errorf("Error opening database: %s", err.Error())
+		return LoadResult{}, fmt.Errorf("Error opening database: %s", err.Error())
 	}
 
 	defer db.Close()
 
-	fileScanner := bufio.NewScanner(reader)
+	if err := waitForMySQL(db, app.WaitTimeout); err != nil {
+		return LoadResult{}, err
+	}
+
+	// use a single connection so session variables apply to all statements
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return LoadResult{}, fmt.Errorf("Error opening database: %s", err.Error())
+	}
+
+	defer conn.Close()
+
+	counter := newProgressCounter("Imported")
+	fileScanner := bufio.NewScanner(&progressReader{r, counter})
 	fileScanner.Split(bufio.ScanLines)
-	cbuffer := make([]byte, 0, bufio.MaxScanTokenSize)
-	fileScanner.Buffer(cbuffer, bufio.MaxScanTokenSize*50) // Otherwise long lines crash the scanner
+	// lines grow the buffer up to the largest statement which can be sent
+	cbuffer := make([]byte, 0, int(app.NetBufferLength))
+	fileScanner.Buffer(cbuffer, int(app.MaxAllowedPacket))
 
-	app.Log(fmt.Sprintf("Importing database to '%s'", app.DB.Name))
+	app.LogEvent("restore_started", fmt.Sprintf("Importing database to '%s'", conf.Name), "database", conf.Name)
 
 	// ensure compatibility between MySQL & Mariadb, including older versions caused by
 	// `STRICT_TRANS_TABLES` and `STRICT_ALL_TABLES`
-	if _, err := db.Exec("SET sql_mode = '';"); err != nil {
-		return err
+	if _, err := conn.ExecContext(ctx, "SET sql_mode = '';"); err != nil {
+		return LoadResult{}, err
+	}
+
+	// tables are not necessarily created in dependency order, so foreign key checks
+	// are disabled for the restore (as with the mysql client), unless enforced
+	if !app.ForeignKeyChecks {
+		app.Log("Disabling foreign key checks for the restore")
+		if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0;"); err != nil {
+			return LoadResult{}, err
+		}
 	}
 
 	sql := ""
 
+	// routines, triggers & events are wrapped in `DELIMITER ;;` blocks
+	delimiter := ";"
+
+	if app.Compat {
+		app.Log("Rewriting MySQL 8 collations for compatibility")
+	}
+
+	// whether the pending statement inserts rows, whose values are never rewritten
+	data := false
+
+	// the number of DEFINER clauses removed with --strip-definers
+	definers := 0
+
+	// INSERT statements are rewritten to skip or overwrite rows with an existing key
+	insert := mysqlDuplicateInserts[app.Duplicates]
+	if insert != "" {
+		app.Log(fmt.Sprintf("Importing rows with %s", insert))
+	}
+
+	// the number of DROP TABLE & CREATE TABLE statements skipped with --no-drop
+	skipped := 0
+	if app.NoDrop {
+		app.Log("Skipping DROP TABLE & CREATE TABLE statements, importing into the existing tables")
+	}
+
+	// the line number of the current & start of the pending statement for error messages
+	lineNo, stmtLine := 0, 0
+
+	// parallel dumps contain a header per part, the versions are only compared once
+	versionChecked := false
+
+	exec := func(stmt string) error {
+		if app.NoDrop && mysqlIsTableSchema(stmt) {
+			skipped++
+			return nil
+		}
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("Error importing statement at line %d (%s): %s%s", stmtLine, sqlSnippet(stmt), err.Error(), mysqlPacketHint(err))
+		}
+		return nil
+	}
+
 	for fileScanner.Scan() {
 		line := fileScanner.Text()
+		lineNo++
+		if sql == "" {
+			data = mysqlIsDataStatement(line)
+		}
+		if app.Compat && !data {
+			line = mysqlCompatReplacer.Replace(line)
+		}
+		if app.StripDefiners {
+			var n int
+			line, n = mysqlStripDefiners(line)
+			definers += n
+		}
+
+		if insert != "" && sql == "" {
+			line = mysqlDuplicateInsert(line, app.Duplicates)
+		}
+
+		if line == SchemaOnlyMarker {
+			if !app.Quiet {
+				fmt.Println("Note: this is a schema-only backup, no table data will be restored")
+			}
+		}
+
+		if strings.HasPrefix(line, serverVersionPrefix) && !versionChecked {
+			versionChecked = true
+			var targetVersion string
+			if err := conn.QueryRowContext(ctx, "SELECT VERSION()").Scan(&targetVersion); err != nil {
+				return LoadResult{}, err
+			}
+			sourceVersion := strings.TrimSpace(strings.TrimPrefix(line, serverVersionPrefix))
+			app.Log(fmt.Sprintf("Backup server version %s, target server version %s", sourceVersion, targetVersion))
+			if msg := mysqlCompatibilityWarning(sourceVersion, targetVersion); msg != "" {
+				fmt.Println(msg)
+			}
+		}
+
+		if strings.HasPrefix(line, timeZonePrefix) {
+			if tzSQL := mysqlTimeZoneSQL(line); tzSQL != "" {
+				app.Log(tzSQL)
+				if _, err := conn.ExecContext(ctx, tzSQL); err != nil {
+					return LoadResult{}, fmt.Errorf("Error setting the time zone: %s", err.Error())
+				}
+			}
+		}
+
+		if strings.HasPrefix(line, charsetPrefix) {
+			if charsetSQL := mysqlCharsetSQL(line); charsetSQL != "" {
+				app.Log(charsetSQL)
+				if _, err := conn.ExecContext(ctx, charsetSQL); err != nil {
+					fmt.Printf("Warning: unable to set database charset: %s\n", err.Error())
+				}
+			}
+		}
+
 		if strings.HasPrefix(line, "/*!") || strings.HasPrefix(line, "--") || line == "" {
 			// ignore comments and blank lines
-		} else if strings.HasSuffix(line, ";") {
+		} else if strings.HasPrefix(strings.ToUpper(line), "DELIMITER ") {
+			delimiter = strings.TrimSpace(line[len("DELIMITER "):])
+		} else if strings.HasSuffix(line, delimiter) {
+			if sql == "" {
+				stmtLine = lineNo
+			}
 			// end of line, append and insert
-			sql = sql + line + " "
+			sql = sql + "\n" + strings.TrimSuffix(line, delimiter)
 			if strings.TrimSpace(sql) != "" {
-				if _, err := db.Exec(sql); err != nil {
-					return err
+				if err := exec(sql); err != nil {
+					return LoadResult{}, err
 				}
 			}
 			// reset sql
 			sql = ""
 		} else {
+			if sql == "" {
+				stmtLine = lineNo
+			}
 			// append sql
 			sql = sql + "\n" + line
 		}
 	}
 
+	if err := fileScanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return LoadResult{}, fmt.Errorf("Error reading '%s': line %d is longer than %s (increase --max-allowed-packet)", source, lineNo+1, ByteToHr(app.MaxAllowedPacket))
+		}
+		return LoadResult{}, fmt.Errorf("Error reading '%s': %s", source, err.Error())
+	}
+
 	// if any sql remains, execute
 	if strings.TrimSpace(sql) != "" {
-		if _, err := db.Exec(sql); err != nil {
-			return err
+		if err := exec(sql); err != nil {
+			return LoadResult{}, err
+		}
+	}
+
+	if !app.ForeignKeyChecks {
+		if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 1;"); err != nil {
+			return LoadResult{}, err
 		}
 	}
 
-	app.Log(fmt.Sprintf("Imported '%s' to '%s'", gzipSQLFile, app.DB.Name))
+	if app.StripDefiners {
+		app.Log(fmt.Sprintf("Removed %d DEFINER clauses", definers))
+	}
 
-	return err
+	if app.NoDrop {
+		app.Log(fmt.Sprintf("Skipped %d DROP TABLE & CREATE TABLE statements", skipped))
+	}
+
+	// a restore which imported nothing (eg: an empty dump) would otherwise succeed silently
+	var tables int
+	if err := conn.QueryRowContext(
+		ctx, "SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE()",
+	).Scan(&tables); err != nil {
+		return LoadResult{}, fmt.Errorf("Error counting the restored tables: %s", err.Error())
+	}
+
+	app.Log(fmt.Sprintf("Database '%s' contains %d tables", conf.Name, tables))
+
+	if tables < app.MinTables {
+		return LoadResult{}, fmt.Errorf(
+			"Database '%s' contains %d tables after the restore, expected at least %d (use --min-tables=0 to disable this check)",
+			conf.Name, tables, app.MinTables,
+		)
+	}
+
+	return LoadResult{Path: source, Database: conf.Name, Bytes: counter.bytes, Duration: time.Since(start), Tables: tables}, nil
+}
+
+// MySQLDuplicateInserts are the statements replacing INSERT for each --duplicates mode
+var mysqlDuplicateInserts = map[string]string{
+	"strict":  "",
+	"ignore":  "INSERT IGNORE",
+	"replace": "REPLACE",
+}
+
+// MySQLDuplicateInsert rewrites the first line of an INSERT statement for the
+// --duplicates mode, eg: INSERT IGNORE INTO. Other lines are unchanged.
+func mysqlDuplicateInsert(line, mode string) string {
+	insert := mysqlDuplicateInserts[mode]
+	if insert == "" || !strings.HasPrefix(line, "INSERT INTO ") {
+		return line
+	}
+
+	return insert + line[len("INSERT"):]
+}
+
+// ValidateDuplicates returns an error if the --duplicates mode is not supported
+func ValidateDuplicates(mode string) error {
+	if _, ok := mysqlDuplicateInserts[mode]; !ok {
+		return fmt.Errorf("Invalid duplicates mode '%s' (strict, ignore or replace)", mode)
+	}
+
+	return nil
+}
+
+// MySQLPacketHint returns a hint for statements exceeding the client's (--max-allowed-packet)
+// or the server's max_allowed_packet, else an empty string
+func mysqlPacketHint(err error) string {
+	if errors.Is(err, mysql.ErrPktTooLarge) {
+		return " (increase --max-allowed-packet)"
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1153 {
+		return " (increase the server's max_allowed_packet, eg: SET GLOBAL max_allowed_packet = 268435456)"
+	}
+
+	return ""
+}
+
+// MySQLIsTableSchema returns whether a statement drops or creates a table
+func mysqlIsTableSchema(stmt string) bool {
+	stmt = strings.ToUpper(strings.TrimSpace(stmt))
+
+	return strings.HasPrefix(stmt, "DROP TABLE ") || strings.HasPrefix(stmt, "CREATE TABLE ")
+}
+
+// SQLSnippet returns the start of a SQL statement on a single line for error messages
+func sqlSnippet(stmt string) string {
+	stmt = strings.Join(strings.Fields(stmt), " ")
+	if len(stmt) > 100 {
+		return stmt[:100] + "..."
+	}
+
+	return stmt
 }
@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// TestDriver is a database/sql driver which records the statements it is sent,
+// failing any statement containing INVALID like a server would
+type testDriver struct {
+	mu         sync.Mutex
+	statements []string
+	open       int
+}
+
+var mysqlTestDriver = &testDriver{}
+
+func init() {
+	sql.Register("ssbak-test", mysqlTestDriver)
+}
+
+func (d *testDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.open++
+
+	return &testConn{d}, nil
+}
+
+type testConn struct {
+	d *testDriver
+}
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("Prepared statements are not supported")
+}
+
+func (c *testConn) Close() error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.open--
+
+	return nil
+}
+
+func (c *testConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("Transactions are not supported")
+}
+
+func (c *testConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.statements = append(c.d.statements, strings.TrimSpace(query))
+
+	if strings.Contains(query, "INVALID") {
+		return nil, errors.New("Error 1064: You have an error in your SQL syntax")
+	}
+
+	return driver.RowsAffected(0), nil
+}
+
+func TestMySQLMatchTables(t *testing.T) {
+	tables := []string{"Member", "MemberPassword", "LoginAttempt", "SessionCache", "File_Live", "File_Versions"}
+
+	tests := []struct {
+		patterns string
+		want     string
+		err      bool
+	}{
+		{"", "", false},
+		{"LoginAttempt", "LoginAttempt", false},
+		{"Member*", "Member,MemberPassword", false},
+		{"*_Versions SessionCache", "SessionCache,File_Versions", false},
+		{"member", "", false},
+		{"File_? *_Live", "File_Live", false},
+		{"[", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := mysqlMatchTables(tables, strings.Fields(tt.patterns))
+		if (err != nil) != tt.err {
+			t.Errorf("mysqlMatchTables(%q) error = %v, want error %v", tt.patterns, err, tt.err)
+			continue
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("mysqlMatchTables(%q) = %v, want %s", tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestMySQLLoadInvalidStatement(t *testing.T) {
+	driverName := mysqlDriver
+	defer func() { mysqlDriver = driverName }()
+	mysqlDriver = "ssbak-test"
+
+	dump := strings.Join([]string{
+		"-- MySQL dump",
+		"CREATE TABLE `Member` (`ID` int);",
+		"INSERT INTO `Member` VALUES (1);",
+		"INVALID STATEMENT;",
+		"INSERT INTO `Member` VALUES (2);",
+	}, "\n")
+
+	file := filepath.Join(t.TempDir(), "database.sql.gz")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzw := gzip.NewWriter(f)
+	if _, err := gzw.Write([]byte(dump)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = MySQLLoadFromGz(app.DBStruct{Name: "SS_test"}, file)
+	if err == nil {
+		t.Fatal("MySQLLoadFromGz() returned no error")
+	}
+	if !strings.Contains(err.Error(), "line 4 (INVALID STATEMENT)") || !strings.Contains(err.Error(), "Error 1064") {
+		t.Errorf("MySQLLoadFromGz() error = %q, want the failing line, statement & server error", err)
+	}
+
+	mysqlTestDriver.mu.Lock()
+	defer mysqlTestDriver.mu.Unlock()
+
+	// the restore stops at the failing statement, and closes its connections
+	last := mysqlTestDriver.statements[len(mysqlTestDriver.statements)-1]
+	if last != "INVALID STATEMENT" {
+		t.Errorf("last statement executed %q, want %q", last, "INVALID STATEMENT")
+	}
+	if mysqlTestDriver.open != 0 {
+		t.Errorf("%d connections left open, want 0", mysqlTestDriver.open)
+	}
+}
+
+func TestMySQLConfigAddr(t *testing.T) {
+	tests := []struct {
+		host   string
+		port   string
+		socket string
+		net    string
+		addr   string
+	}{
+		{"localhost", "", "", "tcp", "localhost:3306"},
+		{"db.example.com", "3307", "", "tcp", "db.example.com:3307"},
+		{"127.0.0.1", "3306", "", "tcp", "127.0.0.1:3306"},
+		{"::1", "", "", "tcp", "[::1]:3306"},
+		{"[::1]", "3307", "", "tcp", "[::1]:3307"},
+		{"fe80::1%eth0", "3306", "", "tcp", "[fe80::1%eth0]:3306"},
+		{"localhost", "3306", "/run/mysqld/mysqld.sock", "unix", "/run/mysqld/mysqld.sock"},
+	}
+
+	for _, tt := range tests {
+		config, err := mysqlConfig(app.DBStruct{Host: tt.host, Port: tt.port, Socket: tt.socket, Charset: "utf8mb4"})
+		if err != nil {
+			t.Errorf("mysqlConfig(%s, %s) returned error: %s", tt.host, tt.port, err)
+			continue
+		}
+		if config.Net != tt.net || config.Addr != tt.addr {
+			t.Errorf("mysqlConfig(%s, %s) = %s %s, want %s %s", tt.host, tt.port, config.Net, config.Addr, tt.net, tt.addr)
+		}
+	}
+}
+
+func TestMySQLDuplicateInsert(t *testing.T) {
+	tests := []struct {
+		mode string
+		line string
+		want string
+	}{
+		{"strict", "INSERT INTO `Member` VALUES (1,'a');", "INSERT INTO `Member` VALUES (1,'a');"},
+		{"ignore", "INSERT INTO `Member` VALUES (1,'a');", "INSERT IGNORE INTO `Member` VALUES (1,'a');"},
+		{"replace", "INSERT INTO `Member` VALUES (1,'a');", "REPLACE INTO `Member` VALUES (1,'a');"},
+		{"ignore", "CREATE TABLE `Member` (", "CREATE TABLE `Member` ("},
+		{"replace", "INSERT IGNORE INTO `Member` VALUES (1,'a');", "INSERT IGNORE INTO `Member` VALUES (1,'a');"},
+		{"replace", "  INSERT INTO `Member` VALUES (1,'a');", "  INSERT INTO `Member` VALUES (1,'a');"},
+	}
+
+	for _, tt := range tests {
+		if got := mysqlDuplicateInsert(tt.line, tt.mode); got != tt.want {
+			t.Errorf("mysqlDuplicateInsert(%q, %s) = %q, want %q", tt.line, tt.mode, got, tt.want)
+		}
+	}
+
+	for _, mode := range []string{"strict", "ignore", "replace"} {
+		if err := ValidateDuplicates(mode); err != nil {
+			t.Errorf("ValidateDuplicates(%s) returned error: %s", mode, err)
+		}
+	}
+	if err := ValidateDuplicates("update"); err == nil {
+		t.Error("ValidateDuplicates(update) returned no error")
+	}
+}
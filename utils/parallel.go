@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aliakseiz/go-mysqldump"
+	"github.com/axllent/ssbak/app"
+)
+
+// MySQLDumpParallel dumps the tables over app.Parallel connections. The tables are
+// partitioned by size, each partition is dumped (in its own transaction) to a
+// separately compressed part, and the parts are then joined into w. Concatenated
+// gzip members & zstd frames are valid streams, so the result restores like any
+// other dump.
+func mysqlDumpParallel(ctx context.Context, db *sql.DB, conf app.DBStruct, w io.Writer, tmpDir string, ignoreTables []string, counter *progressCounter) error {
+	tables, err := queryStrings(db, "SHOW TABLES")
+	if err != nil {
+		return err
+	}
+
+	ignored := map[string]bool{}
+	for _, t := range ignoreTables {
+		ignored[t] = true
+	}
+
+	columns, err := anonymiseColumns(db)
+	if err != nil {
+		return err
+	}
+
+	sizes := mysqlTableSizes(db)
+
+	dumpTables := []string{}
+	for _, t := range tables {
+		if !ignored[t] {
+			dumpTables = append(dumpTables, t)
+		}
+	}
+
+	// largest first, each onto the smallest partition
+	sort.SliceStable(dumpTables, func(i, j int) bool {
+		return sizes[dumpTables[i]] > sizes[dumpTables[j]]
+	})
+
+	partitions := make([][]string, app.Parallel)
+	totals := make([]int64, app.Parallel)
+	for _, t := range dumpTables {
+		smallest := 0
+		for i := range totals {
+			if totals[i] < totals[smallest] {
+				smallest = i
+			}
+		}
+		partitions[smallest] = append(partitions[smallest], t)
+		totals[smallest] += sizes[t]
+	}
+
+	app.Log(fmt.Sprintf("Dumping %d tables over %d connections", len(dumpTables), app.Parallel))
+
+	parts := make([]string, len(partitions))
+	errs := make([]error, len(partitions))
+
+	var wg sync.WaitGroup
+	for i, partition := range partitions {
+		if len(partition) == 0 {
+			continue
+		}
+
+		parts[i] = filepath.Join(tmpDir, fmt.Sprintf("database.part-%d", i))
+		defer os.Remove(parts[i]) // #nosec
+
+		// every table not in this partition is ignored
+		partIgnore := append([]string{}, ignoreTables...)
+		for j, other := range partitions {
+			if j != i {
+				partIgnore = append(partIgnore, other...)
+			}
+		}
+
+		wg.Add(1)
+		go func(i int, partition, partIgnore []string) {
+			defer wg.Done()
+			app.Log(fmt.Sprintf("Dumping tables: %s", strings.Join(partition, ", ")))
+			errs[i] = mysqlDumpPart(ctx, db, parts[i], partIgnore, columns, counter)
+		}(i, partition, partIgnore)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	out := w
+	var ew io.WriteCloser
+	if app.Encrypt {
+		ew, err = newEncryptWriter(w)
+		if err != nil {
+			return err
+		}
+		out = ew
+		defer ew.Close()
+	}
+
+	// the charset & time zone headers are written first, so they are applied before any
+	// tables are created
+	if err := writeCompressed(out, func(cw io.Writer) error {
+		if err := writeMySQLCharset(db, cw, conf.Charset); err != nil {
+			return err
+		}
+		return writeMySQLTimeZone(cw)
+	}); err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		if err := appendFile(out, part); err != nil {
+			return err
+		}
+	}
+
+	if app.IncludeRoutines {
+		if err := writeCompressed(out, func(cw io.Writer) error {
+			return mysqlDumpRoutines(db, cw)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if ew != nil {
+		return ew.Close()
+	}
+
+	return nil
+}
+
+// MySQLDumpPart dumps all tables except the ignored ones to a compressed file,
+// anonymising the given columns
+func mysqlDumpPart(ctx context.Context, db *sql.DB, file string, ignoreTables []string, columns map[string]map[int]string, counter *progressCounter) error {
+	f, err := os.Create(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+	defer f.Close() // #nosec
+
+	cw, err := newCodecWriter(f)
+	if err != nil {
+		return err
+	}
+	defer cw.Close()
+
+	tables := newTableProgressWriter(cw)
+	aw := newAnonymiseWriter(&progressWriter{newRateLimitWriter(&contextWriter{ctx, tables}), counter}, columns)
+
+	dumper := mysqldump.Data{
+		Connection:       db,
+		Out:              aw,
+		MaxAllowedPacket: mysqlInsertSize(),
+		IgnoreTables:     ignoreTables,
+	}
+
+	if err := dumper.Dump(); err != nil {
+		return err
+	}
+
+	if err := aw.Close(); err != nil {
+		return err
+	}
+	tables.Close() // #nosec
+
+	if err := cw.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// MySQLTableSizes returns the approximate size (data & indexes) of each table, or an
+// empty map if the sizes cannot be read
+func mysqlTableSizes(db *sql.DB) map[string]int64 {
+	sizes := map[string]int64{}
+
+	rows, err := db.Query("SELECT TABLE_NAME, COALESCE(DATA_LENGTH, 0) + COALESCE(INDEX_LENGTH, 0) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE()")
+	if err != nil {
+		app.Log(fmt.Sprintf("Unable to read table sizes: %s", err.Error()))
+		return sizes
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var size int64
+		if err := rows.Scan(&name, &size); err == nil {
+			sizes[name] = size
+		}
+	}
+
+	return sizes
+}
+
+// WriteCompressed writes a separately compressed part to w
+func writeCompressed(w io.Writer, fn func(io.Writer) error) error {
+	cw, err := newCodecWriter(w)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(cw); err != nil {
+		cw.Close() // #nosec
+		return err
+	}
+
+	return cw.Close()
+}
+
+// AppendFile copies the contents of a file to w
+func appendFile(w io.Writer, file string) error {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			fmt.Printf("Error closing file: %s\n", err)
+		}
+	}()
+
+	_, err = io.Copy(w, f)
+
+	return err
+}
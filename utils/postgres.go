@@ -0,0 +1,353 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// PostgreSQL has no native Go dump implementation, so the PostgreSQL functions
+// stream to & from the pg_dump, psql, createdb & dropdb client tools.
+
+// PgArgs returns the conf connection arguments for the PostgreSQL client tools
+func pgArgs(conf app.DBStruct) []string {
+	args := []string{"--no-password"}
+	if conf.Host != "" {
+		args = append(args, "--host="+dbHost(conf))
+	}
+	if conf.Port != "" {
+		args = append(args, "--port="+conf.Port)
+	}
+	if conf.Username != "" {
+		args = append(args, "--username="+conf.Username)
+	}
+
+	return args
+}
+
+// RunPg runs a PostgreSQL client tool, passing the password via the environment
+// so it does not show in the process list. Stderr is included in any returned error.
+func runPg(conf app.DBStruct, name string, stdin io.Reader, stdout io.Writer, args ...string) error {
+	if err := ValidateSSL(conf); err != nil {
+		return err
+	}
+
+	bin, err := clientBinary(name)
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+
+	args = append(pgArgs(conf), args...)
+	logCommand(bin, args)
+
+	cmd := exec.CommandContext(app.Context(), bin, args...) // #nosec
+	cmd.Env = append(append(os.Environ(), "PGPASSWORD="+conf.Password), pgSSLEnv(conf)...)
+	if conf.ConnectTimeout > 0 {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("PGCONNECT_TIMEOUT=%d", int(conf.ConnectTimeout.Seconds())))
+	}
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", name, msg)
+		}
+		return fmt.Errorf("%s: %s", name, err.Error())
+	}
+
+	return nil
+}
+
+// ClientBinary returns the path of a database client tool, which can be overridden with
+// an SSBAK_<NAME> environment variable (eg: SSBAK_PG_DUMP=/usr/lib/postgresql/16/bin/pg_dump)
+// to select a specific version, else it is looked up in the PATH (with the PATHEXT
+// extensions on Windows, eg: pg_dump.exe)
+func clientBinary(name string) (string, error) {
+	env := "SSBAK_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+	bin := os.Getenv(env)
+	if bin == "" {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			return "", missingBinaryError(name, env)
+		}
+		return path, nil
+	}
+
+	// LookPath checks the file is executable, and on Windows also tries the PATHEXT
+	// extensions, so eg: SSBAK_PG_DUMP=C:\PostgreSQL\16\bin\pg_dump finds pg_dump.exe
+	path, err := exec.LookPath(filepath.Clean(bin))
+	if err != nil {
+		return "", fmt.Errorf("%s: '%s' is not an executable file", env, bin)
+	}
+
+	app.Log(fmt.Sprintf("Using %s from %s", name, env))
+
+	return path, nil
+}
+
+// ClientPackages are the packages providing each database client tool, by package manager
+var clientPackages = map[string]map[string]string{
+	"postgresql": {"apt": "postgresql-client", "dnf": "postgresql", "brew": "libpq", "choco": "postgresql"},
+	"sqlite":     {"apt": "sqlite3", "dnf": "sqlite", "brew": "sqlite", "choco": "sqlite"},
+	"bzip2":      {"apt": "bzip2", "dnf": "bzip2", "brew": "bzip2", "choco": "bzip2"},
+	"xz":         {"apt": "xz-utils", "dnf": "xz", "brew": "xz", "choco": "xz"},
+}
+
+// MissingBinaryError returns an error for a database client (or compression) tool which
+// cannot be found, suggesting how to install it on the current platform
+func missingBinaryError(name, env string) error {
+	kind, client, title := "Database client", "postgresql", "the PostgreSQL client tools"
+	switch name {
+	case "sqlite3":
+		client, title = "sqlite", "the SQLite client tools"
+	case "bzip2", "xz":
+		kind, client, title = "Compression tool", name, name
+	}
+	pkgs := clientPackages[client]
+
+	var hint string
+	switch runtime.GOOS {
+	case "darwin":
+		hint = fmt.Sprintf("brew install %s", pkgs["brew"])
+	case "windows":
+		hint = fmt.Sprintf("choco install %s", pkgs["choco"])
+	default:
+		hint = fmt.Sprintf("apt install %s (Debian/Ubuntu), dnf install %s (Fedora/RHEL)", pkgs["apt"], pkgs["dnf"])
+	}
+
+	return classify(ErrBinaryNotFound, fmt.Errorf(
+		"%s '%s' not found in $PATH. Install %s, eg: %s, or set %s to the path of '%s'",
+		kind, name, title, hint, env, name,
+	))
+}
+
+// PostgresDumpToGz uses pg_dump to stream a database dump directly into a compressed file
+func PostgresDumpToGz(conf app.DBStruct, gzipFile string) (DumpResult, error) {
+	start := time.Now()
+
+	var dataSize int64
+	if !app.SchemaOnly {
+		var out bytes.Buffer
+		if err := runPg(conf, "psql", nil, &out, "--dbname="+conf.Name, "--tuples-only", "--no-align", "--command=SELECT pg_database_size(current_database())"); err != nil {
+			app.Log(fmt.Sprintf("Unable to read the database size: %s", err.Error()))
+		}
+		dataSize, _ = strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64)
+	}
+	if err := checkDumpSpace(filepath.Dir(gzipFile), dataSize); err != nil {
+		return DumpResult{}, err
+	}
+
+	// dump to a temporary file which is only renamed once complete & verified,
+	// so gzipFile never holds a partial dump
+	tmpFile := gzipFile + ".tmp"
+	app.AddTempFile(tmpFile)
+
+	f, err := os.Create(filepath.Clean(tmpFile))
+	if err != nil {
+		return DumpResult{}, fmt.Errorf("Error creating database backup: %s", err.Error())
+	}
+
+	// the file is closed explicitly once the dump is complete, this only handles early
+	// returns, after which the temporary file is removed (a no-op once it is renamed)
+	defer os.Remove(tmpFile) // #nosec
+	defer f.Close()          // #nosec
+
+	// hash the dump as it is written
+	h := sha256.New()
+
+	gzw, err := newCompressWriter(io.MultiWriter(f, h))
+	if err != nil {
+		return DumpResult{}, err
+	}
+	defer gzw.Close()
+
+	app.LogEvent("dump_started", fmt.Sprintf("Dumping database to '%s'", gzipFile), "file", gzipFile)
+
+	args := []string{"--no-owner", "--no-privileges", "--clean", "--if-exists"}
+	if app.SchemaOnly {
+		app.Log("Dumping database schema only (no data)")
+		if _, err := fmt.Fprintln(gzw, SchemaOnlyMarker); err != nil {
+			return DumpResult{}, err
+		}
+		args = append(args, "--schema-only")
+	}
+	if len(app.DataOnlyTables) > 0 {
+		app.Log(fmt.Sprintf("Dumping data only for tables: %s", strings.Join(app.DataOnlyTables, ", ")))
+		// --strict-names errors if a table does not exist
+		args = append(args, "--data-only", "--strict-names")
+		for _, table := range app.DataOnlyTables {
+			args = append(args, "--table="+table)
+		}
+	}
+	for _, pattern := range app.ExcludeTables {
+		args = append(args, "--exclude-table="+pattern)
+	}
+	// extra arguments are added before the database name so they cannot replace it,
+	// which is passed as --dbname so a name starting with a dash is not read as a flag
+	args = append(append(args, app.ExtraDumpArgs...), "--dbname="+conf.Name)
+
+	// the uncompressed size of the dump
+	counter := newProgressCounter("Dumped")
+
+	tables := newTableProgressWriter(gzw)
+	if err := runPg(conf, "pg_dump", nil, &progressWriter{newRateLimitWriter(tables), counter}, args...); err != nil {
+		return DumpResult{}, fmt.Errorf("Error dumping: %s", err.Error())
+	}
+	tables.Close() // #nosec
+
+	if err := gzw.Close(); err != nil {
+		return DumpResult{}, fmt.Errorf("Error compressing database backup: %s", err.Error())
+	}
+
+	if err := syncClose(f); err != nil {
+		return DumpResult{}, fmt.Errorf("Error closing database backup: %s", err.Error())
+	}
+
+	if err := verifyDump(tmpFile); err != nil {
+		return DumpResult{}, err
+	}
+
+	if err := os.Rename(tmpFile, gzipFile); err != nil {
+		return DumpResult{}, fmt.Errorf("Error saving database backup: %s", err.Error())
+	}
+
+	outSize, _ := CalcSize(gzipFile)
+	result := DumpResult{Path: gzipFile, Database: conf.Name, Bytes: outSize, Checksum: fmt.Sprintf("%x", h.Sum(nil)), Duration: time.Since(start), UncompressedBytes: counter.bytes}
+	logCompression(result)
+	app.LogEvent(
+		"dump_completed", fmt.Sprintf("Wrote %s (%s)", gzipFile, result),
+		"file", gzipFile, "bytes", outSize, "sha256", result.Checksum, "duration", result.Duration.Seconds(), "throughput", result.Throughput(),
+	)
+
+	return result, nil
+}
+
+// PostgresTestConnection verifies the connection settings, distinguishing between a server
+// which cannot be connected to and a database which does not exist
+func PostgresTestConnection(conf app.DBStruct) error {
+	app.Log(fmt.Sprintf("Connecting to PostgreSQL server '%s' as '%s'", conf.Host, conf.Username))
+
+	var out bytes.Buffer
+	query := "SELECT 1 FROM pg_database WHERE datname = '" + strings.Replace(conf.Name, "'", "''", -1) + "'"
+	if err := runPg(conf, "psql", nil, &out, "--dbname=postgres", "--tuples-only", "--no-align", "--command="+query); err != nil {
+		return fmt.Errorf("Cannot connect to PostgreSQL server: %s", err.Error())
+	}
+
+	if strings.TrimSpace(out.String()) != "1" {
+		return fmt.Errorf("Connected to PostgreSQL server, but database '%s' does not exist", conf.Name)
+	}
+
+	if err := runPg(conf, "psql", nil, nil, "--dbname="+conf.Name, "--command=SELECT 1"); err != nil {
+		return fmt.Errorf("Connected to PostgreSQL server, but cannot access database '%s': %s", conf.Name, err.Error())
+	}
+
+	return nil
+}
+
+// PostgresExecSQL runs one or more SQL statements in the database with psql, stopping
+// at the first error
+func PostgresExecSQL(conf app.DBStruct, statements string) error {
+	return runPg(conf, "psql", strings.NewReader(statements), nil, "--quiet", "--set=ON_ERROR_STOP=1", "--dbname="+conf.Name)
+}
+
+// PostgresCreateDB creates a database if it does not exist, optionally dropping it first
+func PostgresCreateDB(conf app.DBStruct, dropDatabase bool) error {
+	if dropDatabase {
+		app.Log(fmt.Sprintf("Dropping database '%s'", conf.Name))
+		if err := runPg(conf, "dropdb", nil, nil, "--if-exists", "--", conf.Name); err != nil {
+			return err
+		}
+	}
+
+	// connect to the maintenance database to check whether the database exists
+	var out bytes.Buffer
+	query := "SELECT 1 FROM pg_database WHERE datname = '" + strings.Replace(conf.Name, "'", "''", -1) + "'"
+	if err := runPg(conf, "psql", nil, &out, "--dbname=postgres", "--tuples-only", "--no-align", "--command="+query); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(out.String()) == "1" {
+		app.Log(fmt.Sprintf("Database '%s' already exists", conf.Name))
+		return nil
+	}
+
+	app.Log(fmt.Sprintf("Creating database '%s'", conf.Name))
+
+	return runPg(conf, "createdb", nil, nil, "--", conf.Name)
+}
+
+// PostgresLoadFromGz loads a compressed database file into the database,
+// streaming the decompressed SQL to psql.
+func PostgresLoadFromGz(conf app.DBStruct, gzipSQLFile string) (LoadResult, error) {
+	start := time.Now()
+
+	if !IsFile(gzipSQLFile) {
+		return LoadResult{}, fmt.Errorf("File '%s' does not exist", gzipSQLFile)
+	}
+
+	f, err := os.Open(filepath.Clean(gzipSQLFile))
+	if err != nil {
+		return LoadResult{}, err
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			fmt.Printf("Error closing file: %s\n", err)
+		}
+	}()
+
+	var bar *progressBar
+	var in io.Reader = f
+	if app.ProgressBar && !app.Quiet {
+		inSize, _ := CalcSize(gzipSQLFile)
+		bar = newProgressBar(inSize)
+		in = &progressReader{f, bar}
+	}
+
+	reader, err := newDecompressReader(in)
+	if err != nil {
+		return LoadResult{}, err
+	}
+	defer reader.Close()
+
+	br := bufio.NewReader(reader)
+	if marker, _ := br.Peek(len(SchemaOnlyMarker)); string(marker) == SchemaOnlyMarker {
+		if !app.Quiet {
+			fmt.Println("Note: this is a schema-only backup, no table data will be restored")
+		}
+	}
+
+	app.LogEvent("restore_started", fmt.Sprintf("Importing database to '%s'", conf.Name), "database", conf.Name)
+
+	counter := newProgressCounter("Imported")
+	args := append(append([]string{"--quiet", "--set=ON_ERROR_STOP=1"}, app.ExtraRestoreArgs...), "--dbname="+conf.Name)
+	if err := runPg(conf, "psql", &progressReader{br, counter}, nil, args...); err != nil {
+		return LoadResult{}, err
+	}
+
+	if bar != nil {
+		bar.finish()
+	}
+
+	result := LoadResult{Path: gzipSQLFile, Database: conf.Name, Bytes: counter.bytes, Duration: time.Since(start)}
+	app.LogEvent(
+		"restore_completed", fmt.Sprintf("Imported '%s' to '%s' (%s in %s)", gzipSQLFile, conf.Name, ByteToHr(result.Bytes), result.Duration.Round(time.Millisecond)),
+		"file", gzipSQLFile, "database", conf.Name, "bytes", result.Bytes, "duration", result.Duration.Seconds(),
+	)
+
+	return result, nil
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+)
+
+func TestPgArgs(t *testing.T) {
+	tests := []struct {
+		conf app.DBStruct
+		want string
+	}{
+		{app.DBStruct{}, "--no-password"},
+		{app.DBStruct{Host: "db", Port: "5433", Username: "ss"}, "--no-password --host=db --port=5433 --username=ss"},
+		{app.DBStruct{Host: "[::1]"}, "--no-password --host=::1"},
+		{app.DBStruct{Host: "::1"}, "--no-password --host=::1"},
+	}
+
+	for _, tt := range tests {
+		if got := strings.Join(pgArgs(tt.conf), " "); got != tt.want {
+			t.Errorf("pgArgs(%+v) = %q, want %q", tt.conf, got, tt.want)
+		}
+	}
+}
+
+func TestClientBinary(t *testing.T) {
+	dir := t.TempDir()
+	ext := ""
+	if runtime.GOOS == "windows" {
+		ext = ".exe"
+	}
+
+	tool := filepath.Join(dir, "ssbak-tool"+ext)
+	if err := ioutil.WriteFile(tool, []byte("#!/bin/sh\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	notExecutable := filepath.Join(dir, "not-executable")
+	if err := ioutil.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir)
+
+	// on Windows the temp dir has a drive letter & backslashes (eg: C:\Users\...\ssbak-tool),
+	// and the .exe extension may be omitted
+	withoutExt := filepath.Join(dir, "ssbak-tool")
+
+	tests := []struct {
+		name     string
+		override string
+		err      string
+	}{
+		{"PATH", "", ""},
+		{"override", tool, ""},
+		{"override without extension", withoutExt, ""},
+		{"override with forward slashes", filepath.ToSlash(withoutExt), ""},
+		{"override with unclean path", filepath.Join(dir, "sub") + string(filepath.Separator) + ".." + string(filepath.Separator) + "ssbak-tool", ""},
+		{"override directory", dir, "is not an executable file"},
+		{"override missing", filepath.Join(dir, "missing"), "is not an executable file"},
+	}
+
+	// Windows has no executable permission bits
+	if runtime.GOOS != "windows" {
+		tests = append(tests, struct {
+			name     string
+			override string
+			err      string
+		}{"override not executable", notExecutable, "is not an executable file"})
+	}
+
+	for _, tt := range tests {
+		t.Setenv("SSBAK_SSBAK_TOOL", tt.override)
+
+		got, err := clientBinary("ssbak-tool")
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if filepath.Clean(got) != tool {
+			t.Errorf("%s: clientBinary() = %q, want %q", tt.name, got, tool)
+		}
+	}
+
+	t.Setenv("SSBAK_SSBAK_TOOL", "")
+	if _, err := clientBinary("ssbak-missing"); err == nil {
+		t.Error("clientBinary() of a missing binary returned no error")
+	}
+}
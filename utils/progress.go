@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// progressInterval is how often progress is logged
+var progressInterval = 5 * time.Second
+
+// ProgressCounter tallies bytes processed, logging the running total every progressInterval.
+// It is safe for concurrent use.
+type progressCounter struct {
+	mu    sync.Mutex
+	label string
+	bytes int64
+	last  time.Time
+	show  bool
+}
+
+// NewProgressCounter returns a counter which only logs when not in quiet mode, the
+// progress bar is not in use, and when the logging output (stderr) is a terminal
+func newProgressCounter(label string) *progressCounter {
+	return &progressCounter{
+		label: label,
+		last:  time.Now(),
+		show:  !app.Quiet && !app.ProgressBar && isTerminal(os.Stderr),
+	}
+}
+
+func (p *progressCounter) add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.bytes += int64(n)
+	if p.show && time.Since(p.last) >= progressInterval {
+		app.Log(fmt.Sprintf("%s %s", p.label, ByteToHr(p.bytes)))
+		p.last = time.Now()
+	}
+}
+
+// Progress is implemented by types tallying processed bytes
+type progress interface {
+	add(n int)
+}
+
+// ProgressWriter counts the bytes written to the underlying writer
+type progressWriter struct {
+	w io.Writer
+	p progress
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.p.add(n)
+
+	return n, err
+}
+
+// ProgressReader counts the bytes read from the underlying reader
+type progressReader struct {
+	r io.Reader
+	p progress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.p.add(n)
+
+	return n, err
+}
+
+// ProgressBar renders the percentage & ETA of a known total to stderr. In a terminal
+// the bar is redrawn in place, otherwise a plain line is printed every progressInterval.
+type progressBar struct {
+	total int64
+	done  int64
+	start time.Time
+	last  time.Time
+	tty   bool
+}
+
+// NewProgressBar returns a progress bar for the total number of bytes
+func newProgressBar(total int64) *progressBar {
+	return &progressBar{
+		total: total,
+		start: time.Now(),
+		last:  time.Now(),
+		tty:   isTerminal(os.Stderr),
+	}
+}
+
+func (b *progressBar) add(n int) {
+	b.done += int64(n)
+
+	interval := progressInterval
+	if b.tty {
+		interval = 200 * time.Millisecond
+	}
+
+	if time.Since(b.last) >= interval {
+		b.render()
+		b.last = time.Now()
+	}
+}
+
+// Finish renders the completed bar
+func (b *progressBar) finish() {
+	b.render()
+	if b.tty {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+func (b *progressBar) render() {
+	if b.total <= 0 {
+		return
+	}
+
+	pct := b.done * 100 / b.total
+	if pct > 100 {
+		pct = 100
+	}
+
+	eta := "--"
+	if b.done > 0 {
+		elapsed := time.Since(b.start)
+		remaining := time.Duration(float64(elapsed) * float64(b.total-b.done) / float64(b.done))
+		eta = remaining.Round(time.Second).String()
+	}
+
+	const width = 30
+	filled := int(pct) * width / 100
+	line := fmt.Sprintf(
+		"[%s%s] %3d%% %s/%s ETA %s",
+		strings.Repeat("=", filled),
+		strings.Repeat(" ", width-filled),
+		pct,
+		ByteToHr(b.done),
+		ByteToHr(b.total),
+		eta,
+	)
+
+	if b.tty {
+		fmt.Fprintf(os.Stderr, "\r%s ", line)
+	} else {
+		fmt.Fprintln(os.Stderr, line)
+	}
+}
+
+// IsTerminal returns whether a file is a terminal (character device)
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// backupNameRegex matches sspak files & the first volume of split sspak files
+var backupNameRegex = regexp.MustCompile(`\.sspak(\.001)?$`)
+
+type backupInfo struct {
+	file    string
+	modTime time.Time
+}
+
+// PruneBackups deletes all but the newest keep backups in a directory, returning
+// the deleted backups. Only files named *.sspak (or split *.sspak.001 volumes)
+// which are sspak archives are considered, along with their volumes & checksum files.
+func PruneBackups(dir string, keep int, dryRun bool) ([]string, error) {
+	if keep < 1 {
+		return nil, errors.New("You must keep at least 1 backup")
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []backupInfo{}
+	for _, e := range entries {
+		if !e.Mode().IsRegular() || !backupNameRegex.MatchString(e.Name()) {
+			continue
+		}
+
+		file := filepath.Join(dir, e.Name())
+
+		if !IsSSPak(file) {
+			app.Log(fmt.Sprintf("Ignoring '%s' (not an sspak archive)", file))
+			continue
+		}
+
+		backups = append(backups, backupInfo{backupBase(file), e.ModTime()})
+	}
+
+	// newest first
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+
+	deleted := []string{}
+
+	if len(backups) <= keep {
+		return deleted, nil
+	}
+
+	for _, b := range backups[keep:] {
+		files := backupVolumes(b.file)
+		if files == nil {
+			files = []string{b.file}
+		}
+		if IsFile(checksumFile(b.file)) {
+			files = append(files, checksumFile(b.file))
+		}
+
+		for _, f := range files {
+			if dryRun {
+				app.Log(fmt.Sprintf("Would delete '%s'", f))
+				continue
+			}
+			app.Log(fmt.Sprintf("Deleting '%s'", f))
+			if err := os.Remove(f); err != nil {
+				return deleted, err
+			}
+		}
+
+		deleted = append(deleted, b.file)
+	}
+
+	return deleted, nil
+}
+
+// IsSSPak returns whether a file (or the first volume of a split sspak) is an
+// sspak archive, ie: a tar file starting with a database.sql.gz or assets.tar.gz
+func IsSSPak(file string) bool {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return false
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			fmt.Printf("Error closing file: %s\n", err)
+		}
+	}()
+
+	header, err := tar.NewReader(f).Next()
+	if err != nil {
+		return false
+	}
+
+	return header.Name == "database.sql.gz" || header.Name == "assets.tar.gz"
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// The throughput of database dumps & asset archiving is limited with --rate-limit by
+// a single token bucket shared by every dump connection & file, so the limit applies
+// to the whole backup, eg: the sum of all parallel dump connections.
+
+// ParseRate parses a rate limit in bytes per second, eg: 50M, 50MB/s or 512K/s
+func ParseRate(s string) (int64, error) {
+	rate, err := ParseSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid rate limit '%s' (eg: 50MB/s)", s)
+	}
+
+	return rate, nil
+}
+
+// RateLimiter is a token bucket allowing up to rate bytes per second, with bursts of
+// up to one second of data. It is safe for concurrent use.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens int64
+	last   time.Time
+}
+
+var (
+	limiter     *rateLimiter
+	limiterOnce sync.Once
+)
+
+// BackupLimiter returns the rate limiter of app.RateLimit, or nil if unlimited
+func backupLimiter() *rateLimiter {
+	limiterOnce.Do(func() {
+		if app.RateLimit > 0 {
+			app.Log(fmt.Sprintf("Limiting throughput to %s/s", ByteToHr(app.RateLimit)))
+			limiter = &rateLimiter{rate: app.RateLimit, tokens: app.RateLimit, last: time.Now()}
+		}
+	})
+
+	return limiter
+}
+
+// Wait blocks until n bytes may be processed, returning early if the app is interrupted
+func (l *rateLimiter) wait(n int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += int64(now.Sub(l.last).Seconds() * float64(l.rate))
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+
+	// the bucket may go negative for writes larger than a burst, delaying later ones
+	l.tokens -= int64(n)
+	if l.tokens >= 0 {
+		return nil
+	}
+
+	delay := time.Duration(float64(-l.tokens) / float64(l.rate) * float64(time.Second))
+
+	select {
+	case <-time.After(delay):
+	case <-app.Context().Done():
+		return app.Context().Err()
+	}
+
+	return nil
+}
+
+// RateLimitWriter limits the throughput of the data written to w
+type rateLimitWriter struct {
+	w io.Writer
+	l *rateLimiter
+}
+
+// NewRateLimitWriter returns w limited to app.RateLimit, or w if unlimited
+func newRateLimitWriter(w io.Writer) io.Writer {
+	l := backupLimiter()
+	if l == nil {
+		return w
+	}
+
+	return &rateLimitWriter{w, l}
+}
+
+func (rw *rateLimitWriter) Write(p []byte) (int, error) {
+	if err := rw.l.wait(len(p)); err != nil {
+		return 0, err
+	}
+
+	return rw.w.Write(p)
+}
+
+// RateLimitReader limits the throughput of the data read from r
+type rateLimitReader struct {
+	r io.Reader
+	l *rateLimiter
+}
+
+// NewRateLimitReader returns r limited to app.RateLimit, or r if unlimited
+func newRateLimitReader(r io.Reader) io.Reader {
+	l := backupLimiter()
+	if l == nil {
+		return r
+	}
+
+	return &rateLimitReader{r, l}
+}
+
+func (rr *rateLimitReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if n > 0 {
+		if werr := rr.l.wait(n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
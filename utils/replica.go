@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// MySQLReplicaStatus returns the replication status of the server, one map of column
+// values per replication channel, or none if the server is not a replica. MySQL 8.0.22+
+// uses SHOW REPLICA STATUS, older versions & MariaDB SHOW SLAVE STATUS.
+func mysqlReplicaStatus(db *sql.DB) ([]map[string]string, error) {
+	result := []map[string]string{}
+
+	rows, err := db.Query("SHOW REPLICA STATUS")
+	if err != nil {
+		rows, err = db.Query("SHOW SLAVE STATUS")
+		if err != nil {
+			return result, err
+		}
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return result, err
+	}
+
+	for rows.Next() {
+		values := make([]sql.NullString, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(ptrs...); err != nil {
+			return result, err
+		}
+
+		status := map[string]string{}
+		for i, col := range cols {
+			status[col] = values[i].String
+		}
+		result = append(result, status)
+	}
+
+	return result, rows.Err()
+}
+
+// ReplicaField returns the first of the named status fields which is set, as the
+// columns were renamed from Master & Slave to Source & Replica in MySQL 8.0.22
+func replicaField(status map[string]string, names ...string) string {
+	for _, name := range names {
+		if v, ok := status[name]; ok {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// MySQLReplicaSummary describes the replication status of a channel, eg: "replica of
+// db1:3306, IO thread Yes, SQL thread Yes, 0s behind the source", and returns whether
+// replication is running (both threads)
+func mysqlReplicaSummary(status map[string]string) (string, bool) {
+	source := replicaField(status, "Source_Host", "Master_Host")
+	if port := replicaField(status, "Source_Port", "Master_Port"); port != "" {
+		source += ":" + port
+	}
+	if channel := replicaField(status, "Channel_Name", "Connection_name"); channel != "" {
+		source += " (channel " + channel + ")"
+	}
+
+	io := replicaField(status, "Replica_IO_Running", "Slave_IO_Running")
+	sqlThread := replicaField(status, "Replica_SQL_Running", "Slave_SQL_Running")
+
+	lag := replicaField(status, "Seconds_Behind_Source", "Seconds_Behind_Master")
+	if lag == "" {
+		lag = "unknown"
+	} else {
+		lag += "s"
+	}
+
+	summary := fmt.Sprintf("replica of %s, IO thread %s, SQL thread %s, %s behind the source", source, io, sqlThread, lag)
+
+	return summary, io == "Yes" && sqlThread == "Yes"
+}
+
+// MySQLLogReplicaStatus logs the replication status of the server before a --replica-safe
+// dump, warning if it is not a replica, or if replication is stopped (the data dumped may
+// then be out of date). The status is only read, replication is never stopped or changed.
+func mysqlLogReplicaStatus(db *sql.DB) {
+	channels, err := mysqlReplicaStatus(db)
+	if err != nil {
+		// requires the REPLICATION CLIENT (or REPLICA MONITOR) privilege
+		app.Log(fmt.Sprintf("Could not check the replication status: %s", err.Error()))
+		return
+	}
+
+	if len(channels) == 0 {
+		if !app.Quiet {
+			fmt.Printf("Warning: --replica-safe is set, but the server is not a replica\n")
+		}
+		return
+	}
+
+	for _, status := range channels {
+		summary, running := mysqlReplicaSummary(status)
+		app.LogEvent("replica_status", "Server is a "+summary, "running", running)
+
+		if !running && !app.Quiet {
+			msg := summary
+			if e := strings.TrimSpace(replicaField(status, "Last_Error")); e != "" {
+				msg += ", " + e
+			}
+			fmt.Printf("Warning: replication is not running on this %s, so the dump may be out of date\n", msg)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package utils
+
+import "testing"
+
+func TestMySQLReplicaSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  map[string]string
+		want    string
+		running bool
+	}{
+		{
+			"replica columns",
+			map[string]string{"Source_Host": "db1", "Source_Port": "3306", "Replica_IO_Running": "Yes", "Replica_SQL_Running": "Yes", "Seconds_Behind_Source": "0", "Channel_Name": ""},
+			"replica of db1:3306, IO thread Yes, SQL thread Yes, 0s behind the source", true,
+		},
+		{
+			"slave columns",
+			map[string]string{"Master_Host": "db1", "Master_Port": "3306", "Slave_IO_Running": "Yes", "Slave_SQL_Running": "Yes", "Seconds_Behind_Master": "12"},
+			"replica of db1:3306, IO thread Yes, SQL thread Yes, 12s behind the source", true,
+		},
+		{
+			"SQL thread stopped",
+			map[string]string{"Source_Host": "db1", "Source_Port": "3306", "Replica_IO_Running": "Yes", "Replica_SQL_Running": "No", "Seconds_Behind_Source": ""},
+			"replica of db1:3306, IO thread Yes, SQL thread No, unknown behind the source", false,
+		},
+		{
+			"IO thread connecting",
+			map[string]string{"Master_Host": "db1", "Master_Port": "3306", "Slave_IO_Running": "Connecting", "Slave_SQL_Running": "Yes", "Seconds_Behind_Master": ""},
+			"replica of db1:3306, IO thread Connecting, SQL thread Yes, unknown behind the source", false,
+		},
+		{
+			"named channel",
+			map[string]string{"Source_Host": "db2", "Source_Port": "3307", "Replica_IO_Running": "Yes", "Replica_SQL_Running": "Yes", "Seconds_Behind_Source": "3", "Channel_Name": "eu"},
+			"replica of db2:3307 (channel eu), IO thread Yes, SQL thread Yes, 3s behind the source", true,
+		},
+	}
+
+	for _, tt := range tests {
+		got, running := mysqlReplicaSummary(tt.status)
+		if got != tt.want || running != tt.running {
+			t.Errorf("%s: mysqlReplicaSummary() = %q, %v, want %q, %v", tt.name, got, running, tt.want, tt.running)
+		}
+	}
+}
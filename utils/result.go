@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// DumpResult describes a completed database dump
+type DumpResult struct {
+	// Path is the compressed dump file
+	Path string
+
+	// Database is the name of the database dumped
+	Database string
+
+	// Bytes is the size of the compressed dump
+	Bytes int64
+
+	// UncompressedBytes is the size of the dump before compression
+	UncompressedBytes int64
+
+	// Checksum is the hex-encoded SHA-256 of the compressed dump
+	Checksum string
+
+	// Duration is how long the dump took
+	Duration time.Duration
+
+	// ServerVersion is the version of the database server dumped, if known
+	ServerVersion string
+
+	// Charset is the default charset & collation of the database, if known
+	Charset string
+
+	// Tables is the number of tables dumped, if known
+	Tables int
+
+	// TableNames are the tables dumped (excluding those skipped), if known
+	TableNames []string
+
+	// SQLFile is the uncompressed copy of the dump kept with --keep-sql, if any
+	SQLFile string
+
+	// SQLBytes is the size of SQLFile
+	SQLBytes int64
+}
+
+// Throughput returns the number of bytes written per second
+func (r DumpResult) Throughput() int64 {
+	if r.Duration <= 0 {
+		return r.Bytes
+	}
+
+	return int64(float64(r.Bytes) / r.Duration.Seconds())
+}
+
+// String returns a human readable summary, eg: 2.3GiB in 45s, 52.3MiB/s
+func (r DumpResult) String() string {
+	return fmt.Sprintf("%s in %s, %s/s", ByteToHr(r.Bytes), r.Duration.Round(time.Millisecond), ByteToHr(r.Throughput()))
+}
+
+// Ratio returns the compression ratio of the dump, eg: 8.0 if compressed to 1/8th of
+// its size, or 0 if the uncompressed size is unknown
+func (r DumpResult) Ratio() float64 {
+	if r.Bytes <= 0 || r.UncompressedBytes <= 0 {
+		return 0
+	}
+
+	return float64(r.UncompressedBytes) / float64(r.Bytes)
+}
+
+// LogCompression logs the compression of a dump, eg: Compressed 5.0GiB → 620.0MiB (8.3x)
+func logCompression(r DumpResult) {
+	if r.Ratio() == 0 {
+		return
+	}
+
+	app.LogEvent(
+		"dump_compression", fmt.Sprintf("Compressed %s → %s (%.1fx)", ByteToHr(r.UncompressedBytes), ByteToHr(r.Bytes), r.Ratio()),
+		"uncompressed_bytes", r.UncompressedBytes, "bytes", r.Bytes, "ratio", r.Ratio(),
+	)
+}
+
+// LoadResult describes a completed database restore
+type LoadResult struct {
+	// Path is the compressed dump file
+	Path string
+
+	// Database is the database (or SQLite file) restored to
+	Database string
+
+	// Bytes is the size of the uncompressed SQL imported
+	Bytes int64
+
+	// Duration is how long the restore took
+	Duration time.Duration
+
+	// Tables is the number of tables in the database after the restore, if known
+	Tables int
+
+	// Rows is the number of rows in the tables after the restore, if known
+	Rows int64
+}
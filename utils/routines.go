@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// go-mysqldump only dumps tables, so stored routines, triggers & events are
+// appended to the dump separately. Their bodies may contain semicolons, so they
+// are wrapped in a `DELIMITER ;;` block which MySQLLoadFromGz understands.
+
+// MySQLDumpRoutines writes the stored procedures, functions, triggers & events of the
+// current database to w
+func mysqlDumpRoutines(db *sql.DB, w io.Writer) error {
+	procedures, err := queryColumn(db, "SHOW PROCEDURE STATUS WHERE Db = DATABASE()", "Name")
+	if err != nil {
+		return err
+	}
+
+	functions, err := queryColumn(db, "SHOW FUNCTION STATUS WHERE Db = DATABASE()", "Name")
+	if err != nil {
+		return err
+	}
+
+	triggers, err := queryColumn(db, "SHOW TRIGGERS", "Trigger")
+	if err != nil {
+		return err
+	}
+
+	events, err := queryColumn(db, "SHOW EVENTS", "Name")
+	if err != nil {
+		return err
+	}
+
+	if len(procedures)+len(functions)+len(triggers)+len(events) == 0 {
+		return nil
+	}
+
+	app.Log(fmt.Sprintf(
+		"Dumping %d procedures, %d functions, %d triggers & %d events",
+		len(procedures), len(functions), len(triggers), len(events),
+	))
+
+	if _, err := io.WriteString(w, "\n--\n-- Dumping routines, triggers & events\n--\n\n"); err != nil {
+		return err
+	}
+
+	for _, name := range procedures {
+		if err := writeCreateRoutine(db, w, "PROCEDURE", name, "Create Procedure"); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range functions {
+		if err := writeCreateRoutine(db, w, "FUNCTION", name, "Create Function"); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range triggers {
+		if err := writeCreateRoutine(db, w, "TRIGGER", name, "SQL Original Statement"); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range events {
+		if err := writeCreateRoutine(db, w, "EVENT", name, "Create Event"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteCreateRoutine writes a DROP & CREATE block for a single routine, trigger or event,
+// reading the CREATE statement from the named column of `SHOW CREATE <typ>`
+func writeCreateRoutine(db *sql.DB, w io.Writer, typ, name, column string) error {
+	quoted := "`" + name + "`"
+
+	rows, err := db.Query("SHOW CREATE " + typ + " " + quoted)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("Could not read %s %s", typ, quoted)
+	}
+
+	values := make([]sql.NullString, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	if err := rows.Scan(ptrs...); err != nil {
+		return err
+	}
+
+	create := ""
+	for i, c := range cols {
+		if c == column && values[i].Valid {
+			create = values[i].String
+		}
+	}
+
+	if create == "" {
+		return fmt.Errorf("Could not read %s %s (insufficient privileges?), use --skip-routines to ignore routines", typ, quoted)
+	}
+
+	_, err = fmt.Fprintf(w, "DROP %s IF EXISTS %s;\nDELIMITER ;;\n%s ;;\nDELIMITER ;\n\n", typ, quoted, create)
+
+	return err
+}
+
+// QueryStrings returns all the columns of all rows of a query as a flat slice of strings
+func queryStrings(db *sql.DB, query string) ([]string, error) {
+	result := []string{}
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return result, err
+	}
+
+	for rows.Next() {
+		values := make([]string, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(ptrs...); err != nil {
+			return result, err
+		}
+
+		result = append(result, values...)
+	}
+
+	return result, rows.Err()
+}
+
+// QueryColumn returns the named column of all rows of a query
+func queryColumn(db *sql.DB, query, column string) ([]string, error) {
+	result := []string{}
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return result, err
+	}
+
+	for rows.Next() {
+		values := make([]sql.NullString, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(ptrs...); err != nil {
+			return result, err
+		}
+
+		for i, c := range cols {
+			if c == column {
+				result = append(result, values[i].String)
+			}
+		}
+	}
+
+	return result, rows.Err()
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/axllent/ssbak/app"
+)
+
+// IsS3 returns whether a backup path is an s3://bucket/key URL
+func isS3(file string) bool {
+	return strings.HasPrefix(file, "s3://")
+}
+
+// ParseS3 returns the bucket & key of an s3://bucket/key URL
+func parseS3(file string) (string, string, error) {
+	u, err := url.Parse(file)
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid S3 URL '%s': %s", file, err.Error())
+	}
+
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" || strings.HasSuffix(key, "/") {
+		return "", "", fmt.Errorf("Invalid S3 URL '%s' (expected s3://bucket/key)", file)
+	}
+
+	return u.Host, key, nil
+}
+
+// S3Client returns an S3 client using the standard AWS credential chain
+// (environment, shared config & credentials files, instance roles etc)
+func s3Client() (*s3.Client, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("Error loading AWS configuration: %s", err.Error())
+	}
+
+	return s3.NewFromConfig(cfg), nil
+}
+
+type s3Writer struct {
+	pw     *io.PipeWriter
+	result chan error
+	done   bool
+}
+
+// NewS3Writer returns a writer streaming to an S3 object with a multipart upload,
+// which is completed when committed. S3 objects are only created (or replaced)
+// once the upload completes.
+func newS3Writer(file string) (*s3Writer, error) {
+	bucket, key, err := parseS3(file)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s3Client()
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	sw := &s3Writer{pw: pw, result: make(chan error, 1)}
+
+	app.Log(fmt.Sprintf("Uploading to '%s'", file))
+
+	go func() {
+		_, err := manager.NewUploader(client).Upload(context.Background(), &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   pr,
+		})
+		if err != nil {
+			err = fmt.Errorf("Error uploading '%s': %s", file, err.Error())
+		}
+		// unblock any pending writes if the upload failed
+		pr.CloseWithError(err)
+		sw.result <- err
+	}()
+
+	return sw, nil
+}
+
+func (sw *s3Writer) Write(p []byte) (int, error) {
+	return sw.pw.Write(p)
+}
+
+// Commit completes the upload, returning any upload error
+func (sw *s3Writer) Commit() error {
+	sw.done = true
+	if err := sw.pw.Close(); err != nil {
+		return err
+	}
+
+	return <-sw.result
+}
+
+// Abort cancels the upload
+func (sw *s3Writer) Abort() {
+	if sw.done {
+		return
+	}
+	sw.done = true
+	sw.pw.CloseWithError(errors.New("Upload aborted")) // #nosec
+	<-sw.result
+}
+
+// OpenS3 opens an S3 object for streaming
+func openS3(file string) (io.ReadCloser, error) {
+	bucket, key, err := parseS3(file)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s3Client()
+	if err != nil {
+		return nil, err
+	}
+
+	app.Log(fmt.Sprintf("Downloading '%s'", file))
+
+	out, err := client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error downloading '%s': %s", file, err.Error())
+	}
+
+	return out.Body, nil
+}
+
+// S3Size returns the size of an S3 object
+func s3Size(file string) (int64, error) {
+	bucket, key, err := parseS3(file)
+	if err != nil {
+		return 0, err
+	}
+
+	client, err := s3Client()
+	if err != nil {
+		return 0, err
+	}
+
+	out, err := client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Error reading '%s': %s", file, err.Error())
+	}
+
+	if out.ContentLength == nil {
+		return 0, errors.New("Unknown object size")
+	}
+
+	return *out.ContentLength, nil
+}
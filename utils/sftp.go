@@ -0,0 +1,280 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/kevinburke/ssh_config"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// IsSFTP returns whether a backup path is an sftp://[user@]host[:port]/path URL
+func isSFTP(file string) bool {
+	return strings.HasPrefix(file, "sftp://")
+}
+
+// SFTPConn is an SFTP session & the SSH connection it runs over
+type sftpConn struct {
+	*sftp.Client
+	ssh *ssh.Client
+}
+
+func (c *sftpConn) close() {
+	c.Client.Close() // #nosec
+	c.ssh.Close()    // #nosec
+}
+
+// SFTPConnect connects to the server of an sftp:// URL, returning the connection
+// and the remote path. Settings (HostName, Port, User & IdentityFile) are read from
+// ~/.ssh/config, keys from the SSH agent and identity files, and the server's host
+// key is checked against ~/.ssh/known_hosts.
+func sftpConnect(file string) (*sftpConn, string, error) {
+	u, err := url.Parse(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("Invalid SFTP URL '%s': %s", file, err.Error())
+	}
+
+	if u.Hostname() == "" || u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		return nil, "", fmt.Errorf("Invalid SFTP URL '%s' (expected sftp://user@host/path/to/file)", file)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, "", err
+	}
+
+	sshConfig := sshConfig(home)
+
+	alias := u.Hostname()
+
+	host, _ := sshConfig.Get(alias, "HostName")
+	if host == "" {
+		host = alias
+	}
+
+	port := u.Port()
+	if port == "" {
+		port, _ = sshConfig.Get(alias, "Port")
+	}
+	if port == "" {
+		port = "22"
+	}
+
+	username := u.User.Username()
+	if username == "" {
+		username, _ = sshConfig.Get(alias, "User")
+	}
+	if username == "" {
+		if current, err := user.Current(); err == nil {
+			username = current.Username
+		}
+	}
+
+	hostKeyCallback, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, "", fmt.Errorf("Error reading known_hosts: %s", err.Error())
+	}
+
+	config := &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeysCallback(sshSigners(sshConfig, alias, home))},
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	addr := net.JoinHostPort(host, port)
+	app.Log(fmt.Sprintf("Connecting to %s@%s", username, addr))
+
+	client, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error connecting to %s: %s", addr, err.Error())
+	}
+
+	sc, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close() // #nosec
+		return nil, "", fmt.Errorf("Error starting SFTP session on %s: %s", addr, err.Error())
+	}
+
+	return &sftpConn{sc, client}, u.Path, nil
+}
+
+// SSHConfig returns the parsed ~/.ssh/config, or an empty config if it does not
+// exist or cannot be parsed
+func sshConfig(home string) *ssh_config.Config {
+	f, err := os.Open(filepath.Join(home, ".ssh", "config"))
+	if err != nil {
+		return &ssh_config.Config{}
+	}
+	defer f.Close() // #nosec
+
+	cfg, err := ssh_config.Decode(f)
+	if err != nil {
+		app.Log(fmt.Sprintf("Error parsing ~/.ssh/config: %s", err.Error()))
+		return &ssh_config.Config{}
+	}
+
+	return cfg
+}
+
+// SSHSigners returns a callback returning the SSH agent keys, followed by the
+// (unencrypted) IdentityFile keys for the host, or the default identity files
+func sshSigners(sshConfig *ssh_config.Config, alias, home string) func() ([]ssh.Signer, error) {
+	return func() ([]ssh.Signer, error) {
+		signers := []ssh.Signer{}
+
+		if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+			if conn, err := net.Dial("unix", sock); err == nil {
+				if s, err := agent.NewClient(conn).Signers(); err == nil {
+					signers = append(signers, s...)
+				}
+			}
+		}
+
+		identities, _ := sshConfig.GetAll(alias, "IdentityFile")
+		if len(identities) == 0 {
+			identities = []string{"~/.ssh/id_ed25519", "~/.ssh/id_ecdsa", "~/.ssh/id_rsa"}
+		}
+
+		for _, id := range identities {
+			if strings.HasPrefix(id, "~/") {
+				id = filepath.Join(home, id[2:])
+			}
+			b, err := ioutil.ReadFile(filepath.Clean(id))
+			if err != nil {
+				continue
+			}
+			s, err := ssh.ParsePrivateKey(b)
+			if err != nil {
+				app.Log(fmt.Sprintf("Skipping SSH key '%s': %s", id, err.Error()))
+				continue
+			}
+			signers = append(signers, s)
+		}
+
+		if len(signers) == 0 {
+			return nil, errors.New("No SSH keys found (SSH agent or identity files)")
+		}
+
+		return signers, nil
+	}
+}
+
+type sftpFile struct {
+	*sftp.File
+	conn   *sftpConn
+	closed bool
+	err    error
+}
+
+// Close closes the remote file & the connection
+func (f *sftpFile) Close() error {
+	if f.closed {
+		return f.err
+	}
+	f.closed = true
+	f.err = f.File.Close()
+	f.conn.close()
+
+	return f.err
+}
+
+type sftpWriter struct {
+	*sftp.File
+	conn       *sftpConn
+	remotePath string
+	done       bool
+}
+
+// NewSFTPWriter returns a writer streaming to a temporary remote file over SFTP,
+// which is renamed once committed
+func newSFTPWriter(file string) (*sftpWriter, error) {
+	conn, remotePath, err := sftpConnect(file)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := conn.Create(remotePath + ".tmp")
+	if err != nil {
+		conn.close()
+		return nil, fmt.Errorf("Could not create '%s': %s", file, err.Error())
+	}
+
+	app.Log(fmt.Sprintf("Uploading to '%s'", file))
+
+	return &sftpWriter{File: f, conn: conn, remotePath: remotePath}, nil
+}
+
+// Commit closes & renames the remote file, and closes the connection
+func (w *sftpWriter) Commit() error {
+	w.done = true
+	defer w.conn.close()
+
+	if err := w.File.Close(); err != nil {
+		w.conn.Remove(w.remotePath + ".tmp") // #nosec
+		return err
+	}
+
+	// PosixRename replaces an existing file, a plain SFTP rename does not
+	if err := w.conn.PosixRename(w.remotePath+".tmp", w.remotePath); err != nil {
+		return fmt.Errorf("Could not rename '%s': %s", w.remotePath+".tmp", err.Error())
+	}
+
+	return nil
+}
+
+// Abort closes & removes the remote file, and closes the connection
+func (w *sftpWriter) Abort() {
+	if w.done {
+		return
+	}
+	w.done = true
+	w.File.Close()                       // #nosec
+	w.conn.Remove(w.remotePath + ".tmp") // #nosec
+	w.conn.close()
+}
+
+// OpenSFTP opens a remote file for streaming over SFTP
+func openSFTP(file string) (io.ReadCloser, error) {
+	conn, remotePath, err := sftpConnect(file)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := conn.Open(remotePath)
+	if err != nil {
+		conn.close()
+		return nil, fmt.Errorf("Could not open '%s': %s", file, err.Error())
+	}
+
+	app.Log(fmt.Sprintf("Downloading '%s'", file))
+
+	return &sftpFile{File: f, conn: conn}, nil
+}
+
+// SFTPSize returns the size of a remote file
+func sftpSize(file string) (int64, error) {
+	conn, remotePath, err := sftpConnect(file)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.close()
+
+	info, err := conn.Stat(remotePath)
+	if err != nil {
+		return 0, fmt.Errorf("Could not stat '%s': %s", file, err.Error())
+	}
+
+	return info.Size(), nil
+}
@@ -0,0 +1,293 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// SQLite databases are single files, which are dumped to & restored from SQL with
+// the sqlite3 command line tool, so backups remain portable plain SQL dumps.
+
+// SQLiteFile returns the path of the SQLite database file, which (like the Silverstripe
+// SQLite3 module) is <SS_SQLITE_DATABASE_PATH>/<SS_DATABASE_NAME>.sqlite, defaulting
+// to the assets/.sqlitedb directory
+func sqliteFile(conf app.DBStruct) string {
+	dir := conf.Path
+	if dir == "" {
+		dir = filepath.Join(app.ProjectRoot, "assets", ".sqlitedb")
+		if IsDir(filepath.Join(app.ProjectRoot, "public")) {
+			dir = filepath.Join(app.ProjectRoot, "public", "assets", ".sqlitedb")
+		}
+	} else if !filepath.IsAbs(dir) {
+		dir = filepath.Join(app.ProjectRoot, dir)
+	}
+
+	return filepath.Join(dir, conf.Name+".sqlite")
+}
+
+// RunSQLite runs sqlite3 on a database file. Stderr is included in any returned error.
+func runSQLite(stdin io.Reader, stdout io.Writer, args ...string) error {
+	bin, err := clientBinary("sqlite3")
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+
+	args = append([]string{"-batch", "-bail"}, args...)
+	logCommand(bin, args)
+
+	cmd := exec.CommandContext(app.Context(), bin, args...) // #nosec
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("sqlite3: %s", msg)
+		}
+		return fmt.Errorf("sqlite3: %s", err.Error())
+	}
+
+	return nil
+}
+
+// SQLiteIntegrityCheck runs PRAGMA integrity_check on a database file
+func sqliteIntegrityCheck(file string) error {
+	var out bytes.Buffer
+	if err := runSQLite(nil, &out, file, "PRAGMA integrity_check;"); err != nil {
+		return err
+	}
+
+	if result := strings.TrimSpace(out.String()); result != "ok" {
+		return fmt.Errorf("SQLite database '%s' failed the integrity check: %s", file, result)
+	}
+
+	return nil
+}
+
+// SQLiteDumpToGz uses sqlite3 to stream a database dump directly into a compressed file
+func SQLiteDumpToGz(conf app.DBStruct, gzipFile string) (DumpResult, error) {
+	start := time.Now()
+
+	if len(app.DataOnlyTables) > 0 || len(app.ExcludeTables) > 0 {
+		return DumpResult{}, errors.New("Data-only & excluded tables are not supported for SQLite databases")
+	}
+
+	dbFile := sqliteFile(conf)
+	if !IsFile(dbFile) {
+		return DumpResult{}, fmt.Errorf("SQLite database '%s' does not exist", dbFile)
+	}
+
+	app.Log(fmt.Sprintf("Checking the integrity of '%s'", dbFile))
+
+	if err := sqliteIntegrityCheck(dbFile); err != nil {
+		return DumpResult{}, err
+	}
+
+	dataSize, _ := CalcSize(dbFile)
+	if app.SchemaOnly {
+		dataSize = 0
+	}
+	if err := checkDumpSpace(filepath.Dir(gzipFile), dataSize); err != nil {
+		return DumpResult{}, err
+	}
+
+	// dump to a temporary file which is only renamed once complete & verified,
+	// so gzipFile never holds a partial dump
+	tmpFile := gzipFile + ".tmp"
+	app.AddTempFile(tmpFile)
+
+	f, err := os.Create(filepath.Clean(tmpFile))
+	if err != nil {
+		return DumpResult{}, fmt.Errorf("Error creating database backup: %s", err.Error())
+	}
+
+	// the file is closed explicitly once the dump is complete, this only handles early
+	// returns, after which the temporary file is removed (a no-op once it is renamed)
+	defer os.Remove(tmpFile) // #nosec
+	defer f.Close()          // #nosec
+
+	// hash the dump as it is written
+	h := sha256.New()
+
+	gzw, err := newCompressWriter(io.MultiWriter(f, h))
+	if err != nil {
+		return DumpResult{}, err
+	}
+	defer gzw.Close()
+
+	app.LogEvent("dump_started", fmt.Sprintf("Dumping database to '%s'", gzipFile), "file", gzipFile)
+
+	command := ".dump"
+	if app.SchemaOnly {
+		app.Log("Dumping database schema only (no data)")
+		if _, err := fmt.Fprintln(gzw, SchemaOnlyMarker); err != nil {
+			return DumpResult{}, err
+		}
+		command = ".schema"
+	}
+
+	// extra arguments are added before the database file so they cannot replace it
+	args := append(append([]string{"-readonly"}, app.ExtraDumpArgs...), dbFile, command)
+
+	// the uncompressed size of the dump
+	counter := newProgressCounter("Dumped")
+
+	if err := runSQLite(nil, &progressWriter{newRateLimitWriter(gzw), counter}, args...); err != nil {
+		return DumpResult{}, fmt.Errorf("Error dumping: %s", err.Error())
+	}
+
+	if err := gzw.Close(); err != nil {
+		return DumpResult{}, fmt.Errorf("Error compressing database backup: %s", err.Error())
+	}
+
+	if err := syncClose(f); err != nil {
+		return DumpResult{}, fmt.Errorf("Error closing database backup: %s", err.Error())
+	}
+
+	if err := verifyDump(tmpFile); err != nil {
+		return DumpResult{}, err
+	}
+
+	if err := os.Rename(tmpFile, gzipFile); err != nil {
+		return DumpResult{}, fmt.Errorf("Error saving database backup: %s", err.Error())
+	}
+
+	outSize, _ := CalcSize(gzipFile)
+	result := DumpResult{Path: gzipFile, Database: conf.Name, Bytes: outSize, Checksum: fmt.Sprintf("%x", h.Sum(nil)), Duration: time.Since(start), UncompressedBytes: counter.bytes}
+	logCompression(result)
+	app.LogEvent(
+		"dump_completed", fmt.Sprintf("Wrote %s (%s)", gzipFile, result),
+		"file", gzipFile, "bytes", outSize, "sha256", result.Checksum, "duration", result.Duration.Seconds(), "throughput", result.Throughput(),
+	)
+
+	return result, nil
+}
+
+// SQLiteTestConnection verifies the database file exists and can be read
+func SQLiteTestConnection(conf app.DBStruct) error {
+	dbFile := sqliteFile(conf)
+
+	app.Log(fmt.Sprintf("Opening SQLite database '%s'", dbFile))
+
+	if !IsFile(dbFile) {
+		return fmt.Errorf("SQLite database '%s' does not exist", dbFile)
+	}
+
+	if err := runSQLite(nil, nil, "-readonly", dbFile, "SELECT 1;"); err != nil {
+		return fmt.Errorf("Cannot open SQLite database '%s': %s", dbFile, err.Error())
+	}
+
+	return nil
+}
+
+// SQLiteExecSQL runs one or more SQL statements in the database file with sqlite3
+func SQLiteExecSQL(conf app.DBStruct, statements string) error {
+	return runSQLite(strings.NewReader(statements), nil, sqliteFile(conf))
+}
+
+// SQLiteCreateDB creates the database directory if it does not exist, optionally
+// deleting the database first. The database file itself is created on restore.
+func SQLiteCreateDB(conf app.DBStruct, dropDatabase bool) error {
+	dbFile := sqliteFile(conf)
+
+	if dropDatabase && IsFile(dbFile) {
+		app.Log(fmt.Sprintf("Deleting database '%s'", dbFile))
+		if err := os.Remove(dbFile); err != nil {
+			return err
+		}
+	}
+
+	return os.MkdirAll(filepath.Dir(dbFile), 0755)
+}
+
+// SQLiteLoadFromGz loads a compressed database file into a new SQLite database,
+// streaming the decompressed SQL to sqlite3. The SQL is imported into a temporary
+// file, which only replaces the existing database once imported & checked.
+func SQLiteLoadFromGz(conf app.DBStruct, gzipSQLFile string) (LoadResult, error) {
+	start := time.Now()
+
+	if !IsFile(gzipSQLFile) {
+		return LoadResult{}, fmt.Errorf("File '%s' does not exist", gzipSQLFile)
+	}
+
+	f, err := os.Open(filepath.Clean(gzipSQLFile))
+	if err != nil {
+		return LoadResult{}, err
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			fmt.Printf("Error closing file: %s\n", err)
+		}
+	}()
+
+	var bar *progressBar
+	var in io.Reader = f
+	if app.ProgressBar && !app.Quiet {
+		inSize, _ := CalcSize(gzipSQLFile)
+		bar = newProgressBar(inSize)
+		in = &progressReader{f, bar}
+	}
+
+	reader, err := newDecompressReader(in)
+	if err != nil {
+		return LoadResult{}, err
+	}
+	defer reader.Close()
+
+	br := bufio.NewReader(reader)
+	if marker, _ := br.Peek(len(SchemaOnlyMarker)); string(marker) == SchemaOnlyMarker {
+		if !app.Quiet {
+			fmt.Println("Note: this is a schema-only backup, no table data will be restored")
+		}
+	}
+
+	counter := newProgressCounter("Imported")
+
+	dbFile := sqliteFile(conf)
+	tmpFile := dbFile + ".tmp"
+	app.AddTempFile(tmpFile)
+	if err := os.Remove(tmpFile); err != nil && !os.IsNotExist(err) {
+		return LoadResult{}, err
+	}
+	defer os.Remove(tmpFile) // #nosec
+
+	app.LogEvent("restore_started", fmt.Sprintf("Importing database to '%s'", dbFile), "database", dbFile)
+
+	if err := runSQLite(&progressReader{br, counter}, nil, append(append([]string{}, app.ExtraRestoreArgs...), tmpFile)...); err != nil {
+		return LoadResult{}, err
+	}
+
+	if err := sqliteIntegrityCheck(tmpFile); err != nil {
+		return LoadResult{}, err
+	}
+
+	if err := os.Rename(tmpFile, dbFile); err != nil {
+		return LoadResult{}, fmt.Errorf("Error replacing database '%s': %s", dbFile, err.Error())
+	}
+
+	if bar != nil {
+		bar.finish()
+	}
+
+	result := LoadResult{Path: gzipSQLFile, Database: dbFile, Bytes: counter.bytes, Duration: time.Since(start)}
+	app.LogEvent(
+		"restore_completed", fmt.Sprintf("Imported '%s' to '%s' (%s in %s)", gzipSQLFile, dbFile, ByteToHr(result.Bytes), result.Duration.Round(time.Millisecond)),
+		"file", gzipSQLFile, "database", dbFile, "bytes", result.Bytes, "duration", result.Duration.Seconds(),
+	)
+
+	return result, nil
+}
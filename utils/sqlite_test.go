@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+)
+
+func TestSQLiteFile(t *testing.T) {
+	root := app.ProjectRoot
+	defer func() { app.ProjectRoot = root }()
+
+	site := t.TempDir()
+	public := t.TempDir()
+	if err := os.Mkdir(filepath.Join(public, "public"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		root string
+		path string
+		want string
+	}{
+		{site, "", filepath.Join(site, "assets", ".sqlitedb", "SS_site.sqlite")},
+		{public, "", filepath.Join(public, "public", "assets", ".sqlitedb", "SS_site.sqlite")},
+		{site, "db", filepath.Join(site, "db", "SS_site.sqlite")},
+		{site, public, filepath.Join(public, "SS_site.sqlite")},
+	}
+
+	for _, tt := range tests {
+		app.ProjectRoot = tt.root
+		if got := sqliteFile(app.DBStruct{Path: tt.path, Name: "SS_site"}); got != tt.want {
+			t.Errorf("sqliteFile(%q) in %s = %q, want %q", tt.path, tt.root, got, tt.want)
+		}
+	}
+}
@@ -2,11 +2,11 @@ package utils
 
 import (
 	"archive/tar"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path"
 	"path/filepath"
 
 	"github.com/axllent/ssbak/app"
@@ -14,7 +14,7 @@ import (
 
 // ExtractSSPak extracts a SSPak (tar) file
 func ExtractSSPak(sspakFile, outDir string) error {
-	r, err := os.Open(filepath.Clean(sspakFile))
+	r, err := openBackup(sspakFile)
 	if err != nil {
 		return err
 	}
@@ -29,7 +29,7 @@ func ExtractSSPak(sspakFile, outDir string) error {
 		return err
 	}
 
-	inSize, _ := CalcSize(sspakFile)
+	inSize, _ := backupSize(sspakFile)
 
 	// Test tmp directory has sufficient space.
 	if err := HasEnoughSpace(outDir, inSize); err != nil {
@@ -81,6 +81,7 @@ func ExtractSSPak(sspakFile, outDir string) error {
 			// copy over contents
 			/* #nosec  - file is streamed from targz to file */
 			if _, err := io.Copy(f, tr); err != nil {
+				f.Close() // #nosec
 				return err
 			}
 
@@ -107,33 +108,34 @@ func CreateSSPak(sspakFile string, files []string) error {
 
 	app.Log(fmt.Sprintf("Creating SSPak archive `%s`", sspakFile))
 
-	outDir := path.Dir(sspakFile)
-	var inSize int64
-	for _, f := range files {
-		size, err := CalcSize(f)
-		if err != nil {
+	if !isRemote(sspakFile) && !isStdio(sspakFile) {
+		outDir := filepath.Dir(sspakFile)
+		var inSize int64
+		for _, f := range files {
+			size, err := CalcSize(f)
+			if err != nil {
+				return err
+			}
+			inSize = inSize + size
+		}
+
+		// Test output directory has sufficient space.
+		if err := HasEnoughSpace(outDir, inSize); err != nil {
 			return err
 		}
-		inSize = inSize + size
 	}
 
-	// Test output directory has sufficient space.
-	if err := HasEnoughSpace(outDir, inSize); err != nil {
+	file, err := createBackup(sspakFile)
+	if err != nil {
 		return err
 	}
 
-	file, err := os.Create(path.Clean(sspakFile))
-	if err != nil {
-		return fmt.Errorf("Could not create '%s': %s", sspakFile, err.Error())
-	}
+	// discard the incomplete archive on error, sspakFile is only replaced once complete
+	defer file.Abort()
 
-	defer func() {
-		if err := file.Close(); err != nil {
-			fmt.Printf("Error closing file: %s\n", err)
-		}
-	}()
-
-	tarWriter := tar.NewWriter(file)
+	// hash the archive as it is written
+	h := sha256.New()
+	tarWriter := tar.NewWriter(&contextWriter{app.Context(), io.MultiWriter(file, h)})
 	defer tarWriter.Close()
 
 	for _, file := range files {
@@ -142,10 +144,30 @@ func CreateSSPak(sspakFile string, files []string) error {
 		}
 	}
 
-	outSize, _ := CalcSize(sspakFile)
-	app.Log(fmt.Sprintf("Wrote '%s' (%s)", sspakFile, ByteToHr(outSize)))
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("Could not write '%s': %s", sspakFile, err.Error())
+	}
 
-	return nil
+	if err := file.Commit(); err != nil {
+		return fmt.Errorf("Could not write '%s': %s", sspakFile, err.Error())
+	}
+
+	if isStdio(sspakFile) {
+		// there is no file to write a checksum file alongside
+		app.LogEvent(
+			"sspak_completed", fmt.Sprintf("Wrote SSPak archive to stdout (sha256 %x)", h.Sum(nil)),
+			"file", sspakFile, "sha256", fmt.Sprintf("%x", h.Sum(nil)),
+		)
+		return nil
+	}
+
+	outSize, _ := backupSize(sspakFile)
+	app.LogEvent(
+		"sspak_completed", fmt.Sprintf("Wrote '%s' (%s)", sspakFile, ByteToHr(outSize)),
+		"file", sspakFile, "bytes", outSize, "sha256", fmt.Sprintf("%x", h.Sum(nil)),
+	)
+
+	return writeChecksum(sspakFile, h)
 }
 
 func addFileToTarWriter(fileName, filePath string, tarWriter *tar.Writer) error {
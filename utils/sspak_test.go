@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSSPakPaths(t *testing.T) {
+	tests := []string{
+		"my site/website backup.sspak",
+		"sité ünïcode/网站.sspak",
+		"-dashed/-website.sspak",
+		"quotes 'and' $vars/site;&.sspak",
+	}
+
+	for _, name := range tests {
+		dir := t.TempDir()
+		sspakFile := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(sspakFile), 0750); err != nil {
+			t.Fatal(err)
+		}
+
+		srcDir := filepath.Join(dir, "src dir")
+		if err := os.Mkdir(srcDir, 0750); err != nil {
+			t.Fatal(err)
+		}
+		gzipFile := filepath.Join(srcDir, "database.sql.gz")
+		if err := ioutil.WriteFile(gzipFile, []byte("dump"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := CreateSSPak(sspakFile, []string{gzipFile}); err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if !IsSSPak(sspakFile) || !IsFile(sspakFile+".sha256") {
+			t.Errorf("%s: archive or checksum file not written", name)
+			continue
+		}
+
+		outDir := filepath.Join(dir, "out -dir ü")
+		if err := ExtractSSPak(sspakFile, outDir); err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if b, err := ioutil.ReadFile(filepath.Join(outDir, "database.sql.gz")); err != nil || string(b) != "dump" {
+			t.Errorf("%s: extracted %q (%v), want %q", name, b, err, "dump")
+		}
+	}
+}
+
+func TestBackupLocations(t *testing.T) {
+	tests := []struct {
+		file   string
+		stdio  bool
+		remote bool
+		volume string
+	}{
+		{"-", true, false, "-.001"},
+		{"--", false, false, "--.001"},
+		{"-website.sspak", false, false, "-website.sspak.001"},
+		{"my site/website backup.sspak", false, false, "my site/website backup.sspak.001"},
+		{`C:\Backups\my site\website.sspak`, false, false, `C:\Backups\my site\website.sspak.001`},
+		{`\\nas\backups\website.sspak`, false, false, `\\nas\backups\website.sspak.001`},
+		{"D:/backups/website.sspak", false, false, "D:/backups/website.sspak.001"},
+		{"s3://bucket/website.sspak", false, true, "s3://bucket/website.sspak.001"},
+		{"sftp://user@host/backups/website.sspak", false, true, "sftp://user@host/backups/website.sspak.001"},
+	}
+
+	for _, tt := range tests {
+		if got := isStdio(tt.file); got != tt.stdio {
+			t.Errorf("isStdio(%q) = %v, want %v", tt.file, got, tt.stdio)
+		}
+		if got := isRemote(tt.file); got != tt.remote {
+			t.Errorf("isRemote(%q) = %v, want %v", tt.file, got, tt.remote)
+		}
+		if got := volumeName(tt.file, 1); got != tt.volume {
+			t.Errorf("volumeName(%q, 1) = %q, want %q", tt.file, got, tt.volume)
+		}
+	}
+}
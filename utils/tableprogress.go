@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// Dumps mark the start of each table's data with a comment, which is picked out of
+// the SQL as it is written, eg:
+// MySQL:      -- Dumping data for table `Member`
+// PostgreSQL: -- Data for Name: Member; Type: TABLE DATA; Schema: public; Owner: site
+// The data of a MySQL table ends where the next table's structure starts.
+const (
+	mysqlTableDataPrefix      = "-- Dumping data for table "
+	mysqlTableStructurePrefix = "-- Table structure for table "
+	postgresTableDataPrefix   = "-- Data for Name: "
+)
+
+// maxTableLine is how much of a line is kept to detect table comments
+const maxTableLine = 512
+
+// TableProgressWriter logs each table as its data is dumped when app.TableProgress is
+// set, along with the size & duration of the previous table. Close() must be called
+// to log the last table.
+type tableProgressWriter struct {
+	w       io.Writer
+	enabled bool
+	line    []byte
+	skip    bool
+	table   string
+	start   time.Time
+	written int64
+	offset  int64
+}
+
+// NewTableProgressWriter returns a tableProgressWriter writing to w
+func newTableProgressWriter(w io.Writer) *tableProgressWriter {
+	return &tableProgressWriter{w: w, enabled: app.TableProgress}
+}
+
+func (tw *tableProgressWriter) Write(p []byte) (int, error) {
+	n, err := tw.w.Write(p)
+	if !tw.enabled {
+		return n, err
+	}
+
+	b := p[:n]
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		segment := b
+		if i >= 0 {
+			segment = b[:i]
+		}
+
+		// only comment lines are kept, and only up to maxTableLine
+		if !tw.skip {
+			if room := maxTableLine - len(tw.line); len(segment) > room {
+				segment = segment[:room]
+			}
+			tw.line = append(tw.line, segment...)
+			if (len(tw.line) >= 2 && !bytes.HasPrefix(tw.line, []byte("--"))) || len(tw.line) == maxTableLine {
+				tw.skip = true
+			}
+		}
+
+		if i < 0 {
+			tw.written += int64(len(b))
+			break
+		}
+
+		tw.written += int64(i + 1)
+		if !tw.skip {
+			tw.checkLine(string(tw.line))
+		}
+		tw.line = tw.line[:0]
+		tw.skip = false
+		b = b[i+1:]
+	}
+
+	return n, err
+}
+
+// CheckLine logs the table if the line marks the start of a table's data
+func (tw *tableProgressWriter) checkLine(line string) {
+	var table string
+	switch {
+	case strings.HasPrefix(line, mysqlTableStructurePrefix):
+		tw.finish()
+		return
+	case strings.HasPrefix(line, mysqlTableDataPrefix):
+		table = inspectTableName(line[len(mysqlTableDataPrefix):])
+	case strings.HasPrefix(line, postgresTableDataPrefix):
+		table = strings.SplitN(line[len(postgresTableDataPrefix):], ";", 2)[0]
+	default:
+		return
+	}
+
+	tw.finish()
+
+	app.Log(fmt.Sprintf("Dumping table '%s'", table))
+	tw.table = table
+	tw.start = time.Now()
+	tw.offset = tw.written
+}
+
+// Finish logs the size & duration of the current table
+func (tw *tableProgressWriter) finish() {
+	if tw.table == "" {
+		return
+	}
+
+	app.Log(fmt.Sprintf(
+		"Dumped table '%s' (%s in %s)",
+		tw.table, ByteToHr(tw.written-tw.offset), time.Since(tw.start).Round(time.Millisecond),
+	))
+	tw.table = ""
+}
+
+// Close logs the last table
+func (tw *tableProgressWriter) Close() error {
+	if tw.enabled {
+		tw.finish()
+	}
+
+	return nil
+}
@@ -71,7 +71,7 @@ func TarGZExtract(inputFilePath, outputFilePath string) (err error) {
 func mkdirAll(dirPath string, perm os.FileMode) (func(), error) {
 	var undoDir string
 
-	for p := dirPath; ; p = path.Dir(p) {
+	for p := dirPath; ; p = filepath.Dir(p) {
 		finfo, err := os.Stat(p)
 		if err == nil {
 			if finfo.IsDir() {
@@ -144,20 +144,25 @@ func compress(inPath, outFilePath, subPath string) (err error) {
 		return errors.New("targz: input directory is empty")
 	}
 
-	file, err := os.Create(path.Clean(outFilePath))
+	file, err := os.Create(filepath.Clean(outFilePath))
 	if err != nil {
 		return err
 	}
 
 	defer func() {
 		if err != nil {
+			// the file is closed once complete, so is only closed here on error
+			file.Close() // #nosec
 			if err := os.Remove(outFilePath); err != nil {
 				panic(err)
 			}
 		}
 	}()
 
-	gzipWriter := gzip.NewWriter(file)
+	gzipWriter, err := newGzipWriter(&contextWriter{app.Context(), file})
+	if err != nil {
+		return err
+	}
 	tarWriter := tar.NewWriter(gzipWriter)
 
 	err = writeDirectory(inPath, tarWriter, subPath)
@@ -175,7 +180,7 @@ func compress(inPath, outFilePath, subPath string) (err error) {
 		return err
 	}
 
-	err = file.Close()
+	err = syncClose(file)
 	if err != nil {
 		return err
 	}
@@ -286,7 +291,7 @@ func writeTarGz(path string, tarWriter *tar.Writer, fileInfo os.FileInfo, subPat
 		return err
 	}
 
-	_, err = io.Copy(tarWriter, file)
+	_, err = io.Copy(tarWriter, newRateLimitReader(file))
 	if err != nil {
 		return err
 	}
@@ -381,7 +386,9 @@ func extract(filePath string, directory string) error {
 		for {
 			n, err := tarReader.Read(buffer)
 			if err != nil && err != io.EOF {
-				panic(err)
+				// close the partially written file & return the error rather than crash
+				file.Close() // #nosec
+				return fmt.Errorf("Error extracting '%s': %s", header.Name, err.Error())
 			}
 			if n == 0 {
 				break
@@ -389,6 +396,7 @@ func extract(filePath string, directory string) error {
 
 			_, err = writer.Write(buffer[:n])
 			if err != nil {
+				file.Close() // #nosec
 				return err
 			}
 		}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// TIMESTAMP columns are converted to & from the session time zone, so with --tz-utc
+// (the default) MySQL dumps are made in UTC, recorded in a `-- Time zone` header line,
+// and restored in the same time zone regardless of the time zones of either server.
+const timeZonePrefix = "-- Time zone"
+
+// UTCTimeZone is the session time zone of MySQL dumps with --tz-utc
+const utcTimeZone = "+00:00"
+
+var timeZoneRegex = regexp.MustCompile(`^[+-]\d{2}:\d{2}$`)
+
+// WriteMySQLTimeZone writes the time zone header of a dump made with --tz-utc
+func writeMySQLTimeZone(w io.Writer) error {
+	if !app.TZUTC {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(w, "%s\t%s\n", timeZonePrefix, utcTimeZone)
+
+	return err
+}
+
+// MySQLTimeZoneSQL returns the statement to apply a `-- Time zone` header line to the
+// restore session, or an empty string if the line is not valid
+func mysqlTimeZoneSQL(line string) string {
+	tz := strings.TrimSpace(strings.TrimPrefix(line, timeZonePrefix))
+	if !timeZoneRegex.MatchString(tz) {
+		return ""
+	}
+
+	return "SET time_zone = '" + tz + "'"
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+)
+
+func TestWriteMySQLTimeZone(t *testing.T) {
+	tzUTC := app.TZUTC
+	defer func() { app.TZUTC = tzUTC }()
+
+	tests := []struct {
+		tzUTC bool
+		want  string
+	}{
+		{true, "-- Time zone\t+00:00\n"},
+		{false, ""},
+	}
+
+	for _, tt := range tests {
+		app.TZUTC = tt.tzUTC
+
+		var buf bytes.Buffer
+		if err := writeMySQLTimeZone(&buf); err != nil {
+			t.Errorf("writeMySQLTimeZone() with --tz-utc=%v returned error: %s", tt.tzUTC, err)
+			continue
+		}
+		if buf.String() != tt.want {
+			t.Errorf("writeMySQLTimeZone() with --tz-utc=%v = %q, want %q", tt.tzUTC, buf.String(), tt.want)
+		}
+
+		// the header written is applied on restore
+		if tt.want != "" {
+			if got := mysqlTimeZoneSQL(buf.String()); got != "SET time_zone = '+00:00'" {
+				t.Errorf("mysqlTimeZoneSQL(%q) = %q", buf.String(), got)
+			}
+		}
+	}
+}
+
+func TestMySQLTimeZoneSQL(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"-- Time zone\t+00:00", "SET time_zone = '+00:00'"},
+		{"-- Time zone -05:30", "SET time_zone = '-05:30'"},
+		{"-- Time zone\tUTC", ""},
+		{"-- Time zone\t+00:00'; DROP TABLE `Member`; --", ""},
+		{"-- Time zone", ""},
+	}
+
+	for _, tt := range tests {
+		if got := mysqlTimeZoneSQL(tt.line); got != tt.want {
+			t.Errorf("mysqlTimeZoneSQL(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
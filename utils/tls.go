@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlTLSKey is the name the custom TLS config is registered as with the MySQL driver
+const mysqlTLSKey = "ssbak"
+
+// SSLMode returns the normalised conf.SSLMode (disabled, preferred, required, verify_ca or
+// verify_identity). If unset it defaults to verify_identity when a CA or client
+// certificate is configured, else disabled.
+func sslMode(conf app.DBStruct) string {
+	mode := strings.Replace(strings.ToLower(conf.SSLMode), "-", "_", -1)
+	if mode == "" {
+		if conf.SSLCA != "" || conf.SSLCert != "" {
+			return "verify_identity"
+		}
+		return "disabled"
+	}
+
+	return mode
+}
+
+// ValidateSSL returns an error if the SSL mode is invalid or a referenced file does not exist
+func ValidateSSL(conf app.DBStruct) error {
+	switch sslMode(conf) {
+	case "disabled", "preferred", "required", "verify_ca", "verify_identity":
+	default:
+		return fmt.Errorf("Invalid SSL mode '%s' (must be disabled, preferred, required, verify_ca or verify_identity)", conf.SSLMode)
+	}
+
+	for _, f := range []struct{ name, path string }{
+		{"SSL CA", conf.SSLCA},
+		{"SSL certificate", conf.SSLCert},
+		{"SSL key", conf.SSLKey},
+	} {
+		if f.path != "" && !IsFile(f.path) {
+			return fmt.Errorf("%s file '%s' does not exist", f.name, f.path)
+		}
+	}
+
+	if (conf.SSLCert == "") != (conf.SSLKey == "") {
+		return errors.New("Both an SSL certificate and key are required for client certificate authentication")
+	}
+
+	if sslMode(conf) == "verify_ca" && conf.SSLCA == "" {
+		return errors.New("SSL mode verify_ca requires an SSL CA file")
+	}
+
+	return nil
+}
+
+// MySQLTLSConfig registers the TLS settings with the MySQL driver, returning the
+// driver's TLSConfig value, or an empty string if TLS is disabled
+func mysqlTLSConfig(conf app.DBStruct) (string, error) {
+	if err := ValidateSSL(conf); err != nil {
+		return "", err
+	}
+
+	mode := sslMode(conf)
+	switch mode {
+	case "disabled":
+		return "", nil
+	case "preferred":
+		if conf.SSLCert == "" && conf.SSLCA == "" {
+			return "preferred", nil
+		}
+	}
+
+	host := dbHost(conf)
+	if host == "" {
+		host = "localhost"
+	}
+
+	config := &tls.Config{ServerName: host} // #nosec - MinVersion left to the server
+
+	if conf.SSLCA != "" {
+		pem, err := ioutil.ReadFile(filepath.Clean(conf.SSLCA))
+		if err != nil {
+			return "", err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return "", fmt.Errorf("Could not parse SSL CA file '%s'", conf.SSLCA)
+		}
+		config.RootCAs = pool
+	}
+
+	if conf.SSLCert != "" {
+		cert, err := tls.LoadX509KeyPair(conf.SSLCert, conf.SSLKey)
+		if err != nil {
+			return "", fmt.Errorf("Could not load SSL certificate: %s", err.Error())
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if mode != "verify_identity" {
+		// encrypt without verifying the hostname, and for required/preferred not the CA either
+		config.InsecureSkipVerify = true // #nosec
+		if mode == "verify_ca" {
+			config.VerifyPeerCertificate = verifyCA(config.RootCAs)
+		}
+	}
+
+	if err := mysql.RegisterTLSConfig(mysqlTLSKey, config); err != nil {
+		return "", err
+	}
+
+	return mysqlTLSKey, nil
+}
+
+// VerifyCA returns a function verifying the server certificate chain against the CA
+// pool, without verifying the server hostname
+func verifyCA(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("Server did not provide an SSL certificate")
+		}
+
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+
+		return err
+	}
+}
+
+// PgSSLEnv returns the libpq environment variables for the SSL settings
+func pgSSLEnv(conf app.DBStruct) []string {
+	modes := map[string]string{
+		"disabled":        "disable",
+		"preferred":       "prefer",
+		"required":        "require",
+		"verify_ca":       "verify-ca",
+		"verify_identity": "verify-full",
+	}
+
+	env := []string{}
+	if conf.SSLMode != "" || conf.SSLCA != "" || conf.SSLCert != "" {
+		env = append(env, "PGSSLMODE="+modes[sslMode(conf)])
+	}
+	if conf.SSLCA != "" {
+		env = append(env, "PGSSLROOTCERT="+conf.SSLCA)
+	}
+	if conf.SSLCert != "" {
+		env = append(env, "PGSSLCERT="+conf.SSLCert, "PGSSLKEY="+conf.SSLKey)
+	}
+
+	return env
+}
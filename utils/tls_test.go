@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// WriteTestCert writes a self-signed certificate & its key to dir
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "db"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"db"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := filepath.Join(dir, "cert.pem")
+	if err := ioutil.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, keyFile
+}
+
+func TestMySQLTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeTestCert(t, dir)
+	invalid := filepath.Join(dir, "invalid.pem")
+	if err := ioutil.WriteFile(invalid, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		conf app.DBStruct
+		want string
+		err  string
+	}{
+		{"default", app.DBStruct{}, "", ""},
+		{"disabled", app.DBStruct{SSLMode: "DISABLED"}, "", ""},
+		{"preferred", app.DBStruct{SSLMode: "preferred"}, "preferred", ""},
+		{"required", app.DBStruct{SSLMode: "required"}, mysqlTLSKey, ""},
+		{"verify-ca", app.DBStruct{SSLMode: "verify-ca", SSLCA: cert}, mysqlTLSKey, ""},
+		{"CA defaults to verify_identity", app.DBStruct{Host: "db", SSLCA: cert}, mysqlTLSKey, ""},
+		{"client certificate", app.DBStruct{SSLMode: "required", SSLCert: cert, SSLKey: key}, mysqlTLSKey, ""},
+		{"preferred with CA", app.DBStruct{SSLMode: "preferred", SSLCA: cert}, mysqlTLSKey, ""},
+		{"invalid mode", app.DBStruct{SSLMode: "always"}, "", "Invalid SSL mode"},
+		{"verify_ca without CA", app.DBStruct{SSLMode: "verify_ca"}, "", "requires an SSL CA"},
+		{"certificate without key", app.DBStruct{SSLCert: cert}, "", "Both an SSL certificate and key"},
+		{"missing CA file", app.DBStruct{SSLCA: filepath.Join(dir, "missing.pem")}, "", "does not exist"},
+		{"invalid CA file", app.DBStruct{SSLCA: invalid}, "", "Could not parse"},
+		{"invalid certificate", app.DBStruct{SSLCert: invalid, SSLKey: key}, "", "Could not load"},
+	}
+
+	for _, tt := range tests {
+		got, err := mysqlTLSConfig(tt.conf)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: mysqlTLSConfig() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPgSSLEnv(t *testing.T) {
+	tests := []struct {
+		conf app.DBStruct
+		want string
+	}{
+		{app.DBStruct{}, ""},
+		{app.DBStruct{SSLMode: "required"}, "PGSSLMODE=require"},
+		{app.DBStruct{SSLMode: "verify_identity"}, "PGSSLMODE=verify-full"},
+		{app.DBStruct{SSLCA: "/ca.pem"}, "PGSSLMODE=verify-full PGSSLROOTCERT=/ca.pem"},
+		{app.DBStruct{SSLMode: "verify-ca", SSLCA: "/ca.pem", SSLCert: "/c.pem", SSLKey: "/k.pem"}, "PGSSLMODE=verify-ca PGSSLROOTCERT=/ca.pem PGSSLCERT=/c.pem PGSSLKEY=/k.pem"},
+	}
+
+	for _, tt := range tests {
+		if got := strings.Join(pgSSLEnv(tt.conf), " "); got != tt.want {
+			t.Errorf("pgSSLEnv(%+v) = %q, want %q", tt.conf, got, tt.want)
+		}
+	}
+}
@@ -177,8 +177,9 @@ func GithubUpdate(repo, appName, currentVersion string) (string, error) {
 	return ver, nil
 }
 
-// DownloadToFile downloads a URL to a file
-func DownloadToFile(url, filepath string) error {
+// DownloadToFile downloads a URL to a file, returning an error if the file cannot be
+// written or closed
+func DownloadToFile(url, filepath string) (err error) {
 	app.Log(fmt.Sprintf("Downloading %s to %s", url, filepath))
 
 	// Get the data
@@ -195,8 +196,8 @@ func DownloadToFile(url, filepath string) error {
 	}
 
 	defer func() {
-		if err := out.Close(); err != nil {
-			fmt.Printf("Error closing file: %s\n", err)
+		if cerr := out.Close(); cerr != nil && err == nil {
+			err = cerr
 		}
 	}()
 
@@ -3,13 +3,18 @@ package utils
 import (
 	"bufio"
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"os"
-	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/axllent/ssbak/app"
+	"github.com/klauspost/pgzip"
 )
 
 // IsFile returns if a path is a file
@@ -90,32 +95,123 @@ func GzipFile(file, output string) error {
 		}
 	}()
 
-	outFile, err := os.Create(path.Clean(output))
+	outFile, err := os.Create(filepath.Clean(output))
 	if err != nil {
 		return err
 	}
 
-	defer func() {
-		if err := outFile.Close(); err != nil {
-			fmt.Printf("Error closing file: %s\n", err)
-		}
-	}()
+	// the file is closed explicitly once written, this only handles early returns
+	defer outFile.Close() // #nosec
 
 	buf := bufio.NewWriter(outFile)
-	defer buf.Flush()
 
-	gz := gzip.NewWriter(buf)
+	gz, err := newGzipWriter(buf)
+	if err != nil {
+		return err
+	}
 	defer gz.Close()
 
 	inSize, _ := CalcSize(file)
 	app.Log(fmt.Sprintf("Compressing '%s' (%s) to '%s'", file, ByteToHr(inSize), output))
 
-	_, err = io.Copy(gz, src)
+	if _, err := io.Copy(gz, src); err != nil {
+		return err
+	}
+
+	// the gzip stream is closed (writing its footer) before the buffer is flushed to
+	// the file, which is then synced to disk
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if err := syncClose(outFile); err != nil {
+		return err
+	}
 
 	outSize, _ := CalcSize(output)
 	app.Log(fmt.Sprintf("Wrote '%s' (%s)", output, ByteToHr(outSize)))
 
-	return err
+	return nil
+}
+
+// SyncClose syncs a written file to disk before closing it, so a backup which was
+// written without error is not lost or truncated if the system crashes afterwards
+func syncClose(f *os.File) error {
+	if err := f.Sync(); err != nil {
+		f.Close() // #nosec
+		return err
+	}
+
+	return f.Close()
+}
+
+// SyncDir syncs a directory to disk, so files renamed into it survive a crash. This
+// is not supported on all platforms (eg: Windows), so errors are only logged.
+func syncDir(dir string) {
+	d, err := os.Open(filepath.Clean(dir))
+	if err != nil {
+		app.Log(fmt.Sprintf("Unable to sync '%s': %s", dir, err.Error()))
+		return
+	}
+	defer d.Close() // #nosec
+
+	if err := d.Sync(); err != nil {
+		app.Log(fmt.Sprintf("Unable to sync '%s': %s", dir, err.Error()))
+	}
+}
+
+// ValidateCompressionLevel returns an error if the gzip compression level is out of range
+func ValidateCompressionLevel(level int) error {
+	if level < gzip.BestSpeed || level > gzip.BestCompression {
+		return fmt.Errorf(
+			"Invalid compression level %d (must be between %d and %d)",
+			level,
+			gzip.BestSpeed,
+			gzip.BestCompression,
+		)
+	}
+
+	return nil
+}
+
+// NewGzipWriter returns a parallel gzip writer using the configured compression level,
+// block size & number of workers. The output is standard gzip.
+func newGzipWriter(w io.Writer) (*pgzip.Writer, error) {
+	if err := ValidateCompressionLevel(app.CompressionLevel); err != nil {
+		return nil, err
+	}
+
+	gz, err := pgzip.NewWriterLevel(w, app.CompressionLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := app.GzipWorkers
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	if err := gz.SetConcurrency(app.GzipBlockSize, workers); err != nil {
+		return nil, fmt.Errorf("Invalid gzip block size: %s", err.Error())
+	}
+
+	return gz, nil
+}
+
+// ContextWriter returns the context error on write once the context is done
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw *contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return cw.w.Write(p)
 }
 
 // SkipResampled detects whether the assets is a resampled image
@@ -132,3 +228,36 @@ func skipResampled(filePath string) bool {
 
 	return false
 }
+
+// BackupFilename returns a timestamped backup filename from a format, replacing
+// {name} with the (database) name, {date} with the date (YYYYMMDD) and {time} with
+// the time (HHMM), eg: `{name}-{date}-{time}.sspak` -> `mydb-20240115-1330.sspak`
+func BackupFilename(format, database string, t time.Time) string {
+	name := regexp.MustCompile(`[^a-zA-Z0-9_\-\.]+`).ReplaceAllString(database, "_")
+	if name == "" {
+		name = "ssbak"
+	}
+
+	file := strings.NewReplacer(
+		"{name}", name,
+		"{date}", t.Format("20060102"),
+		"{time}", t.Format("1504"),
+	).Replace(format)
+
+	if !strings.HasSuffix(file, ".sspak") {
+		file = file + ".sspak"
+	}
+
+	return file
+}
+
+// InSlice returns whether a string is in a slice
+func InSlice(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+)
+
+func TestBackupFilename(t *testing.T) {
+	now := time.Date(2024, 1, 15, 13, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		format   string
+		database string
+		want     string
+	}{
+		{"{name}-{date}-{time}.sspak", "SS_mysite", "SS_mysite-20240115-1330.sspak"},
+		{"{name}-{date}", "my site/../db", "my_site_.._db-20240115.sspak"},
+		{"backups/{name}.sspak", "", "backups/ssbak.sspak"},
+		{"{name}", "--drop", "--drop.sspak"},
+		{"{name}", "sité", "sit_.sspak"},
+	}
+
+	for _, tt := range tests {
+		if got := BackupFilename(tt.format, tt.database, now); got != tt.want {
+			t.Errorf("BackupFilename(%q, %q) = %q, want %q", tt.format, tt.database, got, tt.want)
+		}
+	}
+}
+
+func TestGzipWriterRoundTrip(t *testing.T) {
+	level, blockSize, workers := app.CompressionLevel, app.GzipBlockSize, app.GzipWorkers
+	defer func() { app.CompressionLevel, app.GzipBlockSize, app.GzipWorkers = level, blockSize, workers }()
+
+	var sql []byte
+	for i := 0; i < 20000; i++ {
+		sql = append(sql, fmt.Sprintf("INSERT INTO `Member` VALUES (%d,'user%d@example.com');\n", i, i)...)
+	}
+
+	tests := []struct {
+		level     int
+		blockSize int
+		workers   int
+	}{
+		{6, 1 << 20, 0},
+		{1, 64 << 10, 1},
+		{9, 64 << 10, 4},
+	}
+
+	for _, tt := range tests {
+		app.CompressionLevel, app.GzipBlockSize, app.GzipWorkers = tt.level, tt.blockSize, tt.workers
+
+		var compressed bytes.Buffer
+		gz, err := newGzipWriter(&compressed)
+		if err != nil {
+			t.Errorf("newGzipWriter(%+v): %s", tt, err)
+			continue
+		}
+		if _, err := gz.Write(sql); err != nil {
+			t.Errorf("newGzipWriter(%+v): %s", tt, err)
+			continue
+		}
+		if err := gz.Close(); err != nil {
+			t.Errorf("newGzipWriter(%+v): %s", tt, err)
+			continue
+		}
+
+		// the output must be readable as standard gzip
+		r, err := gzip.NewReader(&compressed)
+		if err != nil {
+			t.Errorf("newGzipWriter(%+v): %s", tt, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("newGzipWriter(%+v): %s", tt, err)
+			continue
+		}
+		if !bytes.Equal(got, sql) {
+			t.Errorf("newGzipWriter(%+v): decompressed %d bytes, want %d", tt, len(got), len(sql))
+		}
+	}
+
+	app.GzipBlockSize = 1024
+	if _, err := newGzipWriter(ioutil.Discard); err == nil {
+		t.Error("newGzipWriter() with a 1KB block size returned no error")
+	}
+}
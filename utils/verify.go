@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// A backup is verified by restoring it into a temporary database on the same server,
+// which is dropped afterwards, so the configured database is never touched.
+
+// verifyDatabaseSuffix is appended to the database name to name the temporary database
+const verifyDatabaseSuffix = "_ssbak_verify_"
+
+// VerifyBackup restores a compressed MySQL database file into a temporary database,
+// on the conf server, counting the rows of each restored table, then drops the
+// temporary database
+func VerifyBackup(conf app.DBStruct, gzipSQLFile string) (LoadResult, error) {
+	if conf.Type != "MySQL" {
+		return LoadResult{}, fmt.Errorf("Verifying a restore is only supported for MySQL databases, not %s", conf.Type)
+	}
+
+	name, err := verifyDatabaseName(conf.Name)
+	if err != nil {
+		return LoadResult{}, err
+	}
+
+	tmp := conf
+	tmp.Name = name
+
+	if err := MySQLCreateDB(tmp, false); err != nil {
+		return LoadResult{}, err
+	}
+
+	defer func() {
+		if err := mysqlDropDB(tmp); err != nil {
+			app.LogError(fmt.Errorf("Error dropping the temporary database '%s': %s", name, err.Error()))
+		}
+	}()
+
+	result, err := MySQLLoadFromGz(tmp, gzipSQLFile)
+	if err != nil {
+		return result, err
+	}
+
+	rows, err := mysqlCountRows(tmp)
+	if err != nil {
+		return result, classifyError(err)
+	}
+	result.Rows = rows
+
+	return result, nil
+}
+
+// VerifyDatabaseName returns a unique temporary database name based on the database
+// name, eg: SS_mysite_ssbak_verify_1a2b3c4d
+func verifyDatabaseName(base string) (string, error) {
+	randBytes := make([]byte, 4)
+	if _, err := rand.Read(randBytes); err != nil {
+		return "", err
+	}
+	suffix := verifyDatabaseSuffix + hex.EncodeToString(randBytes)
+
+	// MySQL database names are limited to 64 characters
+	if max := 64 - len(suffix); len(base) > max {
+		base = base[:max]
+	}
+
+	return base + suffix, nil
+}
+
+// MySQLCountRows returns the total number of rows of the tables (not views) in the
+// conf database, reading every table
+func mysqlCountRows(conf app.DBStruct) (int64, error) {
+	config, err := mysqlConfig(conf)
+	if err != nil {
+		return 0, err
+	}
+
+	db, err := sql.Open(mysqlDriver, config.FormatDSN())
+	if err != nil {
+		return 0, fmt.Errorf("Error opening database: %s", err.Error())
+	}
+
+	defer db.Close()
+
+	rows, err := db.QueryContext(
+		app.Context(),
+		"SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE'",
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close() // #nosec
+			return 0, err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close() // #nosec
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, table := range tables {
+		var count int64
+		if err := db.QueryRowContext(app.Context(), "SELECT COUNT(*) FROM `"+strings.Replace(table, "`", "``", -1)+"`").Scan(&count); err != nil {
+			return 0, fmt.Errorf("Error reading table '%s': %s", table, err.Error())
+		}
+		app.Log(fmt.Sprintf("Table '%s' contains %d rows", table, count))
+		total += count
+	}
+
+	return total, nil
+}
+
+// MySQLDropDB drops the conf database
+func mysqlDropDB(conf app.DBStruct) error {
+	if err := validateMySQLDatabaseName(conf.Name); err != nil {
+		return err
+	}
+
+	config, err := mysqlConfig(conf)
+	if err != nil {
+		return err
+	}
+	config.DBName = "" // reset the database name
+
+	db, err := sql.Open(mysqlDriver, config.FormatDSN())
+	if err != nil {
+		return fmt.Errorf("Error opening database: %s", err.Error())
+	}
+
+	defer db.Close()
+
+	app.Log(fmt.Sprintf("Dropping database '%s'", conf.Name))
+	_, err = db.Exec("DROP DATABASE IF EXISTS `" + conf.Name + "`")
+
+	return err
+}
@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+)
+
+var sizeRegex = regexp.MustCompile(`(?i)^(\d+)\s*([kmgt]?)i?b?$`)
+
+// ParseSize parses a human readable size such as 500M or 2G into bytes
+func ParseSize(s string) (int64, error) {
+	matches := sizeRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if len(matches) != 3 {
+		return 0, fmt.Errorf("Invalid size '%s' (eg: 500M, 2G)", s)
+	}
+
+	n, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("Invalid size '%s' (eg: 500M, 2G)", s)
+	}
+
+	multipliers := map[string]int64{"": 1, "k": 1 << 10, "m": 1 << 20, "g": 1 << 30, "t": 1 << 40}
+
+	return n * multipliers[strings.ToLower(matches[2])], nil
+}
+
+// VolumeName returns the filename of a volume of a split backup, eg: website.sspak.001
+func volumeName(file string, n int) string {
+	return fmt.Sprintf("%s.%03d", file, n)
+}
+
+// BackupBase returns the base filename of a backup, allowing the first volume of a
+// split backup to be given instead, eg: website.sspak.001
+func backupBase(file string) string {
+	if strings.HasSuffix(file, ".001") && !IsFile(strings.TrimSuffix(file, ".001")) {
+		return strings.TrimSuffix(file, ".001")
+	}
+
+	return file
+}
+
+// BackupVolumes returns the volume filenames of a split backup, or nil if the
+// backup is a single file (or does not exist)
+func backupVolumes(file string) []string {
+	file = backupBase(file)
+	if IsFile(file) {
+		return nil
+	}
+
+	volumes := []string{}
+	for n := 1; IsFile(volumeName(file, n)); n++ {
+		volumes = append(volumes, volumeName(file, n))
+	}
+
+	return volumes
+}
+
+type volumeReader struct {
+	volumes []string
+	f       *os.File
+}
+
+func (vr *volumeReader) Read(p []byte) (int, error) {
+	for {
+		if vr.f == nil {
+			if len(vr.volumes) == 0 {
+				return 0, io.EOF
+			}
+			f, err := os.Open(filepath.Clean(vr.volumes[0]))
+			if err != nil {
+				return 0, err
+			}
+			vr.f = f
+			vr.volumes = vr.volumes[1:]
+		}
+
+		n, err := vr.f.Read(p)
+		if err == io.EOF {
+			if err := vr.f.Close(); err != nil {
+				return n, err
+			}
+			vr.f = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+
+		return n, err
+	}
+}
+
+func (vr *volumeReader) Close() error {
+	if vr.f == nil {
+		return nil
+	}
+
+	return vr.f.Close()
+}
+
+// VolumeWriter writes sequential volumes of up to size bytes each. Volumes are
+// written to temporary files which are only renamed once committed.
+type volumeWriter struct {
+	file    string
+	size    int64
+	part    int
+	f       *os.File
+	written int64
+	done    bool
+}
+
+// NewVolumeWriter returns a writer splitting its output into volumes of size bytes,
+// eg: website.sspak.001, website.sspak.002 etc
+func newVolumeWriter(file string, size int64) *volumeWriter {
+	return &volumeWriter{file: file, size: size}
+}
+
+func (vw *volumeWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if vw.f == nil || vw.written >= vw.size {
+			if err := vw.next(); err != nil {
+				return n, err
+			}
+		}
+
+		chunk := p
+		if int64(len(chunk)) > vw.size-vw.written {
+			chunk = chunk[:vw.size-vw.written]
+		}
+
+		c, err := vw.f.Write(chunk)
+		n += c
+		vw.written += int64(c)
+		if err != nil {
+			return n, err
+		}
+		p = p[c:]
+	}
+
+	return n, nil
+}
+
+// Next closes the current volume and creates the next one
+func (vw *volumeWriter) next() error {
+	if vw.f != nil {
+		if err := syncClose(vw.f); err != nil {
+			return err
+		}
+	}
+
+	vw.part++
+	vw.f = nil
+	f, err := os.Create(filepath.Clean(volumeName(vw.file, vw.part) + ".tmp"))
+	if err != nil {
+		return fmt.Errorf("Could not create '%s': %s", volumeName(vw.file, vw.part), err.Error())
+	}
+	app.AddTempFile(f.Name())
+
+	app.Log(fmt.Sprintf("Writing volume '%s'", volumeName(vw.file, vw.part)))
+
+	vw.f = f
+	vw.written = 0
+
+	return nil
+}
+
+// Commit closes the last volume and renames all volumes, replacing any existing
+// backup of the same name (split or not), including stale volumes left over from
+// a previous (larger) backup
+func (vw *volumeWriter) Commit() error {
+	vw.done = true
+	if vw.f != nil {
+		if err := syncClose(vw.f); err != nil {
+			vw.removeTmp()
+			return err
+		}
+	}
+
+	for n := 1; n <= vw.part; n++ {
+		if err := os.Rename(volumeName(vw.file, n)+".tmp", volumeName(vw.file, n)); err != nil {
+			return err
+		}
+	}
+
+	for n := vw.part + 1; IsFile(volumeName(vw.file, n)); n++ {
+		if err := os.Remove(volumeName(vw.file, n)); err != nil {
+			return err
+		}
+	}
+
+	if IsFile(vw.file) {
+		if err := os.Remove(vw.file); err != nil {
+			return err
+		}
+	}
+	syncDir(filepath.Dir(vw.file))
+
+	return nil
+}
+
+// Abort closes & removes the temporary volumes
+func (vw *volumeWriter) Abort() {
+	if vw.done {
+		return
+	}
+	vw.done = true
+	if vw.f != nil {
+		vw.f.Close() // #nosec
+	}
+	vw.removeTmp()
+}
+
+func (vw *volumeWriter) removeTmp() {
+	for n := 1; n <= vw.part; n++ {
+		os.Remove(volumeName(vw.file, n) + ".tmp") // #nosec
+	}
+}
@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+		err  bool
+	}{
+		{"512", 512, false},
+		{"500M", 500 << 20, false},
+		{"2G", 2 << 30, false},
+		{"2gb", 2 << 30, false},
+		{"1KiB", 1 << 10, false},
+		{" 1T ", 1 << 40, false},
+		{"0", 0, true},
+		{"1.5G", 0, true},
+		{"-1M", 0, true},
+		{"M", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSize(tt.size)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseSize(%q) error = %v, want error %v", tt.size, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestVolumes(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int64
+		writes []string
+		want   []int64
+	}{
+		{"single volume", 100, []string{"0123456789"}, []int64{10}},
+		{"exact boundary", 5, []string{"01234", "56789"}, []int64{5, 5}},
+		{"write across boundary", 4, []string{"012345", "6789"}, []int64{4, 4, 2}},
+		{"small writes", 3, []string{"0", "12", "345", "6", "789"}, []int64{3, 3, 3, 1}},
+	}
+
+	for _, tt := range tests {
+		file := filepath.Join(t.TempDir(), "my site.sspak")
+
+		vw := newVolumeWriter(file, tt.size)
+		var data []byte
+		for _, w := range tt.writes {
+			if _, err := vw.Write([]byte(w)); err != nil {
+				t.Fatalf("%s: %s", tt.name, err)
+			}
+			data = append(data, w...)
+		}
+		if err := vw.Commit(); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+
+		volumes := backupVolumes(file)
+		if len(volumes) != len(tt.want) {
+			t.Errorf("%s: %d volumes, want %d", tt.name, len(volumes), len(tt.want))
+			continue
+		}
+		for i, v := range volumes {
+			if size, _ := CalcSize(v); size != tt.want[i] {
+				t.Errorf("%s: volume %s is %d bytes, want %d", tt.name, v, size, tt.want[i])
+			}
+		}
+
+		// the first volume can be given instead of the base name
+		if got := backupVolumes(file + ".001"); len(got) != len(volumes) {
+			t.Errorf("%s: %d volumes from the first volume, want %d", tt.name, len(got), len(volumes))
+		}
+
+		vr := &volumeReader{volumes: volumes}
+		got, err := ioutil.ReadAll(vr)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+		vr.Close() // #nosec
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: reassembled %q, want %q", tt.name, got, data)
+		}
+	}
+}
+
+func TestVolumesReplaceStale(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "site.sspak")
+
+	// a previous, larger, backup of the same name
+	for _, name := range []string{file, volumeName(file, 1), volumeName(file, 2), volumeName(file, 3)} {
+		if err := ioutil.WriteFile(name, []byte("old"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vw := newVolumeWriter(file, 4)
+	if _, err := vw.Write([]byte("012345")); err != nil {
+		t.Fatal(err)
+	}
+	if err := vw.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if IsFile(file) || IsFile(volumeName(file, 3)) {
+		t.Error("stale backup files were not removed")
+	}
+	if got := backupVolumes(file); len(got) != 2 {
+		t.Errorf("%d volumes, want 2", len(got))
+	}
+}
+
+func TestVolumesAbort(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "site.sspak")
+
+	vw := newVolumeWriter(file, 4)
+	if _, err := vw.Write([]byte("012345")); err != nil {
+		t.Fatal(err)
+	}
+	vw.Abort()
+
+	files, err := os.ReadDir(filepath.Dir(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("%d files left after aborting, want 0", len(files))
+	}
+}
+
+func TestVolumesGzipStream(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "site.sspak")
+	var sql []byte
+	for i := 0; i < 2000; i++ {
+		sql = append(sql, fmt.Sprintf("INSERT INTO `Member` VALUES (%d,'%x@example.com');\n", i, i*7919)...)
+	}
+
+	vw := newVolumeWriter(file, 4096)
+
+	// volumes end part way through the gzip blocks
+	gzw := gzip.NewWriter(vw)
+	for i := 0; i < len(sql); i += 777 {
+		end := i + 777
+		if end > len(sql) {
+			end = len(sql)
+		}
+		if _, err := gzw.Write(sql[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vw.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(backupVolumes(file)); n < 2 {
+		t.Fatalf("%d volumes, want at least 2", n)
+	}
+
+	r, err := openBackup(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(gzr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, sql) {
+		t.Errorf("reassembled %d bytes, want %d", len(got), len(sql))
+	}
+}
@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aliakseiz/go-mysqldump"
+	"github.com/axllent/ssbak/app"
+)
+
+// go-mysqldump always selects every row, so tables with a --where condition are
+// ignored by the dumper and appended to the dump separately, with their rows
+// written in the same format as go-mysqldump.
+
+// ParseWhere parses table:condition pairs into a map of table names to SQL WHERE
+// conditions, eg: `LoginAttempt:Created > '2024-01-01'`
+func ParseWhere(pairs []string) (map[string]string, error) {
+	where := map[string]string{}
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, ":", 2)
+		table := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || table == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("Invalid --where '%s' (expected table:condition)", pair)
+		}
+		if strings.Contains(table, "`") {
+			return nil, fmt.Errorf("Invalid table name '%s'", table)
+		}
+		if _, ok := where[table]; ok {
+			return nil, fmt.Errorf("Multiple --where conditions for table '%s'", table)
+		}
+		where[table] = strings.TrimSpace(parts[1])
+	}
+
+	return where, nil
+}
+
+// WhereTables returns the sorted names of the tables with a --where condition
+func whereTables() []string {
+	tables := []string{}
+	for table := range app.Where {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	return tables
+}
+
+// MySQLDumpWhere writes the structure & matching rows of the tables with a --where
+// condition to w, returning an error if any of the tables do not exist or are excluded
+func mysqlDumpWhere(db *sql.DB, w io.Writer, ignoreTables []string) error {
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // #nosec
+
+	for _, table := range whereTables() {
+		var count int
+		if err := tx.QueryRow(
+			"SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", table,
+		).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("Table '%s' does not exist", table)
+		}
+		if InSlice(table, ignoreTables) {
+			return fmt.Errorf("Table '%s' is excluded, so cannot be filtered with --where", table)
+		}
+	}
+
+	if _, err := io.WriteString(w, "\nSET FOREIGN_KEY_CHECKS=0;\n"); err != nil {
+		return err
+	}
+
+	for _, table := range whereTables() {
+		app.Log(fmt.Sprintf("Dumping rows of '%s' where %s", table, app.Where[table]))
+
+		var name, create string
+		if err := tx.QueryRow("SHOW CREATE TABLE `"+table+"`").Scan(&name, &create); err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(
+			w,
+			"\n--\n-- Table structure for table `%s`\n--\n\nDROP TABLE IF EXISTS `%s`;\n%s;\n\n--\n-- Dumping data for table `%s` (WHERE %s)\n--\n\n",
+			table, table, create, table, app.Where[table],
+		); err != nil {
+			return err
+		}
+
+		if err := mysqlWriteRows(tx, w, table, app.Where[table]); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "\nSET FOREIGN_KEY_CHECKS=1;\n")
+
+	return err
+}
+
+// Queryer is implemented by both *sql.DB & *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// MySQLWriteRows writes the rows of a table matching the where condition to w as
+// INSERT statements of up to mysqlInsertSize() bytes each, ie: --net-buffer-length
+// (itself limited to --max-allowed-packet), or one row each with --skip-extended-insert
+func mysqlWriteRows(q queryer, w io.Writer, table, where string) error {
+	rows, err := q.Query("SELECT * FROM `" + table + "` WHERE " + where) // #nosec
+	if err != nil {
+		return fmt.Errorf("Error selecting rows of '%s': %s", table, err.Error())
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+
+	// scan types match go-mysqldump (unsigned integers are quoted strings)
+	values := make([]interface{}, len(types))
+	for i, t := range types {
+		st := t.ScanType()
+		switch {
+		case t.DatabaseTypeName() == "BLOB":
+			values[i] = &sql.RawBytes{}
+		case st != nil && st.Kind() >= reflect.Int && st.Kind() <= reflect.Int64:
+			values[i] = &sql.NullInt64{}
+		default:
+			values[i] = &sql.NullString{}
+		}
+	}
+
+	var insert bytes.Buffer
+	for rows.Next() {
+		if err := rows.Scan(values...); err != nil {
+			return err
+		}
+
+		row := mysqlRowValues(values)
+		if insert.Len() != 0 && insert.Len()+len(row) > mysqlInsertSize()-1 {
+			insert.WriteString(";\n")
+			if _, err := insert.WriteTo(w); err != nil {
+				return err
+			}
+		}
+
+		if insert.Len() == 0 {
+			fmt.Fprintf(&insert, "INSERT INTO `%s` VALUES ", table)
+		} else {
+			insert.WriteString(",")
+		}
+		insert.WriteString(row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if insert.Len() != 0 {
+		insert.WriteString(";\n")
+		_, err = insert.WriteTo(w)
+	}
+
+	return err
+}
+
+// MySQLRowValues formats scanned row values as an SQL values list, eg: (1,'abc',NULL)
+func mysqlRowValues(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = "NULL"
+		switch v := value.(type) {
+		case *sql.NullString:
+			if v.Valid {
+				parts[i] = "'" + mysqldump.Sanitize(v.String) + "'"
+			}
+		case *sql.NullInt64:
+			if v.Valid {
+				parts[i] = fmt.Sprintf("%d", v.Int64)
+			}
+		case *sql.RawBytes:
+			if len(*v) > 0 {
+				parts[i] = "_binary '" + mysqldump.Sanitize(string(*v)) + "'"
+			}
+		}
+	}
+
+	return "(" + strings.Join(parts, ",") + ")"
+}